@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"gradechecker/pkg/config"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const defaultAccount = config.DefaultAccount
+
+// Account is a single CIS user monitored by the bot.
+// Every account has its own credentials, session, transcript file and
+// notification routing, so several students can share one daemon.
+type Account struct {
+	Name          string
+	Username      string
+	Password      string
+	TranscriptURL string
+	ResultsURL    string
+	Source        string
+	PDFFile       string
+	Notify        NotifySettings
+}
+
+// Label returns a prefix for log lines and notifications.
+// The default account has no label to keep single-user output unchanged.
+func (a Account) Label() string {
+	if a.Name == defaultAccount {
+		return ""
+	}
+	return "[" + a.Name + "] "
+}
+
+// loadAccounts returns the accounts of the current configuration.
+//
+// Without accounts in the config file or ACCOUNTS, the classic single-user
+// variables (CIS_USERNAME, ...) form the "default" account. Notification
+// settings fall back to the global ones so a shared channel only has to be
+// configured once.
+func loadAccounts() []Account {
+	cfg := currentConfig()
+	var accounts []Account
+	for _, a := range cfg.Accounts {
+		acc := Account{
+			Name:          a.Name,
+			Username:      a.Username,
+			Password:      a.Password,
+			TranscriptURL: a.TranscriptURL,
+			ResultsURL:    a.ResultsURL,
+			Source:        a.Source,
+			PDFFile:       "grades.pdf",
+			Notify:        notifySettings(cfg.AccountNotify(a)),
+		}
+		if acc.TranscriptURL == "" {
+			acc.TranscriptURL = transcriptURL
+		}
+		if acc.ResultsURL == "" {
+			acc.ResultsURL = resultsURL
+		}
+		if acc.Name != defaultAccount {
+			acc.PDFFile = "grades-" + config.EnvSuffix(acc.Name) + ".pdf"
+		}
+		accounts = append(accounts, acc)
+	}
+	return accounts
+}
+
+// selectAccounts returns the account with the given name, or all accounts
+// if name is empty.
+func selectAccounts(name string) ([]Account, error) {
+	accounts := loadAccounts()
+	if name == "" {
+		return accounts, nil
+	}
+	for _, acc := range accounts {
+		if acc.Name == name {
+			return []Account{acc}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown account %q", name)
+}
+
+// notifyAccount returns the account whose notification settings a test
+// notification uses: the named one, or else the first configured account.
+// Without any account the global settings are used.
+func notifyAccount(name string) (Account, error) {
+	accounts, err := selectAccounts(name)
+	if err != nil {
+		return Account{}, err
+	}
+	if len(accounts) == 0 {
+		return Account{Name: defaultAccount, Notify: notifySettings(currentConfig().Notify.Discord)}, nil
+	}
+	return accounts[0], nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// sessions keeps one HTTP client (and cookie jar) per account so sessions
+// survive between check cycles and never leak between accounts.
+type sessions map[string]*http.Client
+
+func (s sessions) client(account string) (*http.Client, error) {
+	if c, ok := s[account]; ok {
+		return c, nil
+	}
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+	c := &http.Client{
+		Jar:     jar,
+		Timeout: 60 * time.Second,
+	}
+	s[account] = c
+	return c, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"gradechecker/pkg/config"
+	"testing"
+)
+
+func TestNotifyAccount(t *testing.T) {
+	t.Cleanup(func() { current.Store(nil) })
+	env := map[string]string{
+		"ACCOUNTS":           "alice,bob",
+		"CIS_USERNAME_ALICE": "alice", "CIS_PASSWORD_ALICE": "a",
+		"CIS_USERNAME_BOB": "bob", "CIS_PASSWORD_BOB": "b",
+	}
+	cfg, err := config.Load("", func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Store(cfg)
+
+	// Without a "default" account the first one is used
+	if acc, err := notifyAccount(""); err != nil || acc.Name != "alice" {
+		t.Errorf("notifyAccount(\"\") = %q, %v, want alice", acc.Name, err)
+	}
+	if acc, err := notifyAccount("bob"); err != nil || acc.Name != "bob" {
+		t.Errorf("notifyAccount(\"bob\") = %q, %v", acc.Name, err)
+	}
+	if _, err := notifyAccount(defaultAccount); err == nil {
+		t.Error("found the default account, which is not configured")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gradechecker/pkg/config"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	quarantineDir = "quarantine"
+
+	// maxCountDrop is the share of stored grades a new snapshot may lose
+	// before it is considered broken.
+	maxCountDrop = 0.5
+	// maxUnknownShare is the share of grades with an unrecognised format
+	// a snapshot may contain.
+	maxUnknownShare = 0.3
+)
+
+var (
+	// reGradeFormat matches the grade formats CIS uses.
+	reGradeFormat = regexp.MustCompile(`(?i)^(\d[,.]\d|#|(nicht )?bestanden|anerkannt|angerechnet|(mit erfolg )?teilgenommen|krank|entschuldigt|nicht erschienen|rücktritt|ausstehend)(\s|$)`)
+	// reNotAName matches texts that are never module names, like grades or credit points.
+	reNotAName = regexp.MustCompile(`(?i)^(\d[,.]\d|#|\d+ cp|i\d+)$`)
+)
+
+// checkSnapshot sanity-checks freshly parsed grades before they are applied.
+// stored is the number of grade rows already in the database for the account.
+// It returns a description of every problem found.
+func checkSnapshot(stored int, grades []Grade) []string {
+	var problems []string
+
+	if stored > 0 && len(grades) == 0 {
+		problems = append(problems, fmt.Sprintf("no grades found, %d stored", stored))
+	} else if stored >= 4 && float64(len(grades)) < float64(stored)*(1-maxCountDrop) {
+		problems = append(problems, fmt.Sprintf("grade count dropped from %d to %d", stored, len(grades)))
+	}
+
+	unknown := 0
+	for _, g := range grades {
+		if !reGradeFormat.MatchString(strings.TrimSpace(g.Grade)) {
+			unknown++
+		}
+		if reNotAName.MatchString(g.Module) {
+			problems = append(problems, fmt.Sprintf("module name %q looks like a grade", g.Module))
+		}
+	}
+	if len(grades) > 0 && float64(unknown)/float64(len(grades)) > maxUnknownShare {
+		problems = append(problems, fmt.Sprintf("%d of %d grades have an unknown format", unknown, len(grades)))
+	}
+
+	return problems
+}
+
+// quarantineSnapshot keeps a rejected snapshot for later inspection:
+// the parsed grades and problems as JSON and, if present, the transcript PDF.
+func quarantineSnapshot(acc Account, grades []Grade, problems []string) (string, error) {
+	if err := os.MkdirAll(quarantineDir, 0700); err != nil {
+		return "", err
+	}
+	base := filepath.Join(quarantineDir, fmt.Sprintf("%s-%s", config.EnvSuffix(acc.Name), time.Now().Format("20060102-150405")))
+
+	data, err := json.MarshalIndent(struct {
+		Account  string   `json:"account"`
+		Problems []string `json:"problems"`
+		Grades   []Grade  `json:"grades"`
+	}{acc.Name, problems, grades}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := writePrivateFile(base+".json", data); err != nil {
+		return "", err
+	}
+
+	if pdfData, err := readPrivateFile(acc.PDFFile); err == nil {
+		if err := writePrivateFile(base+".pdf", pdfData); err != nil {
+			return "", err
+		}
+	}
+	return base, nil
+}
+
+// rejectSnapshot quarantines a suspicious snapshot and queues a single
+// "parser needs attention" alert. Further alerts are suppressed until a
+// snapshot passes the checks again.
+func rejectSnapshot(ctx context.Context, db Store, acc Account, grades []Grade, problems []string) {
+	slog.Warn("Parser output looks wrong, not applying it", "account", acc.Name, "problems", strings.Join(problems, "; "))
+
+	path, err := quarantineSnapshot(acc, grades, problems)
+	if err != nil {
+		slog.Error("Failed to quarantine snapshot", "account", acc.Name, "err", err)
+	} else {
+		slog.Info("Snapshot quarantined", "account", acc.Name, "path", path+".*")
+	}
+
+	err = db.Tx(ctx, func(tx Store) error {
+		alerted, err := tx.Status(ctx, "parser_alert:"+acc.Name)
+		if err != nil || alerted != "" {
+			return err
+		}
+		msg := fmt.Sprintf("%sParser needs attention: the transcript could not be read reliably (%s). "+
+			"No grades were changed; the snapshot was quarantined.", acc.Label(), strings.Join(problems, "; "))
+		if err := enqueueNotification(ctx, tx, acc, msg); err != nil {
+			return err
+		}
+		return tx.SetStatus(ctx, "parser_alert:"+acc.Name, now())
+	})
+	if err != nil {
+		slog.Error("Error storing parser alert", "account", acc.Name, "err", err)
+	}
+}
+
+// clearParserAlert re-arms the parser alert after a good snapshot.
+func clearParserAlert(ctx context.Context, tx Store, acc Account) error {
+	_, err := tx.DeleteStatus(ctx, "parser_alert:"+acc.Name)
+	return err
+}
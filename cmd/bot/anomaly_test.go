@@ -0,0 +1,70 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSnapshot(t *testing.T) {
+	good := []Grade{
+		{Module: "Mathematik I", Grade: "1,7"},
+		{Module: "Statistik", Grade: "5,0"},
+		{Module: "Statistik", Grade: "nicht bestanden", OccurrenceIndex: 1},
+		{Module: "Recht", Grade: "#"},
+	}
+
+	tests := []struct {
+		name   string
+		stored int
+		grades []Grade
+		want   string
+	}{
+		{"first run", 0, good, ""},
+		{"unchanged", 4, good, ""},
+		{"empty", 4, nil, "no grades found"},
+		{"dropped", 10, good, "grade count dropped"},
+		{"garbled grades", 0, []Grade{
+			{Module: "Mathematik I", Grade: "Mathematik II"},
+			{Module: "Statistik", Grade: "6 CP I102"},
+			{Module: "Recht", Grade: "1,0"},
+		}, "unknown format"},
+		{"shifted columns", 0, []Grade{
+			{Module: "1,7", Grade: "Mathematik I"},
+		}, "looks like a grade"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := checkSnapshot(tt.stored, tt.grades)
+			got := strings.Join(problems, "; ")
+			if tt.want == "" && got != "" {
+				t.Errorf("unexpected problems: %s", got)
+			}
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("problems %q do not mention %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// The anonymised corpus consists of real-world layouts and must never be
+// rejected as a parser failure.
+func TestCheckSnapshotAcceptsCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/transcripts/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, ".golden.json") {
+			continue
+		}
+		grades, err := parseFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := checkSnapshot(len(grades), grades); len(problems) > 0 {
+			t.Errorf("%s rejected: %v", file, problems)
+		}
+	}
+}
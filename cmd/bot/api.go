@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"gradechecker/pkg/config"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiTokenFile = "api-token"
+
+// startAPI serves the HTTP API in the background if it is enabled.
+// api.addr sets the listen address ("off" disables the API; by default it
+// is only reachable from this machine) and api.token the bearer token;
+// without a token a random one is generated once and kept in the
+// api-token file. The returned function shuts the server down.
+func startAPI(db Store, version string, cfg config.API) func() {
+	addr := cfg.Addr
+	if addr == "off" {
+		return func() {}
+	}
+	token, err := apiToken(context.Background(), cfg.Token)
+	if err != nil {
+		slog.Error("API disabled", "err", err)
+		return func() {}
+	}
+
+	// Cancelled on shutdown to end the open event streams
+	base, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newAPI(db, token, version),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+	go func() {
+		slog.Info("API listening", "url", "http://"+addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("API server failed", "err", err)
+		}
+	}()
+	return func() {
+		cancel()
+		ctx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		srv.Shutdown(ctx)
+	}
+}
+
+// apiToken returns the configured token (resolved once on startup, see
+// config.Resolve) or the token in the api-token
+// file, creating the file with a random token if needed.
+func apiToken(ctx context.Context, configured string) (string, error) {
+	if configured != "" {
+		return resolveSecret(ctx, configured)
+	}
+	if data, err := os.ReadFile(apiTokenFile); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := os.WriteFile(apiTokenFile, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	slog.Info("Generated an API token", "file", apiTokenFile)
+	return token, nil
+}
+
+// api implements the HTTP API. All responses are JSON; errors have the
+// form {"error": "..."}.
+type api struct {
+	db      Store
+	bus     *eventBus
+	health  *healthState
+	token   string
+	version string
+	started time.Time
+}
+
+func newAPI(db Store, token, version string) http.Handler {
+	a := &api{db: db, bus: bus, health: health, token: token, version: version, started: time.Now()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/grades", a.grades)
+	mux.HandleFunc("GET /api/grades/{id}/history", a.history)
+	mux.HandleFunc("GET /api/status", a.status)
+	mux.HandleFunc("GET /api/stats", a.stats)
+	mux.HandleFunc("POST /api/check", a.check)
+	mux.HandleFunc("POST /api/notifiers/{name}/test", a.testNotifier)
+	mux.HandleFunc("GET /api/events", a.events)
+	mux.HandleFunc("GET /metrics", a.metrics)
+	mux.HandleFunc("GET /healthz", a.healthz)
+	mux.HandleFunc("GET /readyz", a.readyz)
+	return a.auth(mux)
+}
+
+// auth requires "Authorization: Bearer <token>" on every request except
+// the health probes. As EventSource cannot send headers, the event stream
+// also accepts ?token=.
+func (a *api) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && r.URL.Path == "/api/events" {
+			given, ok = r.URL.Query().Get("token"), true
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gradechecker"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// grades lists the stored grades, optionally filtered by ?account= and
+// ?module= (substring).
+func (a *api) grades(w http.ResponseWriter, r *http.Request) {
+	grades, err := a.db.Grades(r.Context(), r.URL.Query().Get("account"), r.URL.Query().Get("module"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if grades == nil {
+		grades = []storedGrade{}
+	}
+	writeJSON(w, http.StatusOK, grades)
+}
+
+// history returns a grade with all events recorded for it, oldest first.
+func (a *api) history(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid grade id")
+		return
+	}
+	g, err := a.db.Grade(r.Context(), id)
+	if errors.Is(err, errNotFound) {
+		writeError(w, http.StatusNotFound, "grade not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	events, err := a.db.Events(r.Context(), g.Account, g.Module, g.OccurrenceIndex)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Grade  storedGrade  `json:"grade"`
+		Events []GradeEvent `json:"events"`
+	}{g, events})
+}
+
+// status returns the version, uptime and the system_status table.
+func (a *api) status(w http.ResponseWriter, r *http.Request) {
+	status, err := a.db.Statuses(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Version   string            `json:"version"`
+		StartedAt string            `json:"started_at"`
+		Status    map[string]string `json:"status"`
+	}{a.version, a.started.Format(time.RFC3339), status})
+}
+
+// gradeStats summarises the stored grades.
+type gradeStats struct {
+	Grades         int            `json:"grades"`
+	GradesByStatus map[string]int `json:"grades_by_status"`
+	Modules        int            `json:"modules"`
+	Pending        int            `json:"pending"`
+	// Average is the mean of the numeric grades, counting the latest
+	// attempt of every module; null if there are none.
+	Average       *float64       `json:"average"`
+	Events        map[string]int `json:"events"`
+	OutboxPending int            `json:"outbox_pending"`
+	OutboxFailed  int            `json:"outbox_failed"`
+}
+
+func (a *api) stats(w http.ResponseWriter, r *http.Request) {
+	s, err := queryStats(r.Context(), a.db)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+func queryStats(ctx context.Context, db Store) (gradeStats, error) {
+	s := gradeStats{GradesByStatus: map[string]int{}}
+	grades, err := db.Grades(ctx, "", "")
+	if err != nil {
+		return s, err
+	}
+
+	latest := make(map[string]storedGrade)
+	for _, g := range grades {
+		s.Grades++
+		s.GradesByStatus[g.Status]++
+		if g.Status == eventRemoved {
+			continue
+		}
+		if strings.TrimSpace(g.Grade) == "#" {
+			s.Pending++
+		}
+		key := g.Account + "\x00" + g.Module
+		if cur, ok := latest[key]; !ok || g.OccurrenceIndex > cur.OccurrenceIndex {
+			latest[key] = g
+		}
+	}
+	s.Modules = len(latest)
+
+	var sum float64
+	var n int
+	for _, g := range latest {
+		if v, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(g.Grade), ",", ".", 1), 64); err == nil {
+			sum += v
+			n++
+		}
+	}
+	if n > 0 {
+		avg := sum / float64(n)
+		s.Average = &avg
+	}
+
+	if s.Events, err = db.EventCounts(ctx); err != nil {
+		return s, err
+	}
+	s.OutboxPending, s.OutboxFailed, err = db.OutboxCounts(ctx)
+	return s, err
+}
+
+// check asks the check loop to run right away.
+func (a *api) check(w http.ResponseWriter, r *http.Request) {
+	select {
+	case checkRequests <- struct{}{}:
+	default:
+		// A check is already queued
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+}
+
+// testNotifier sends a test message through a backend, using the settings
+// of ?account= (default: the first account).
+func (a *api) testNotifier(w http.ResponseWriter, r *http.Request) {
+	acc, err := notifyAccount(r.URL.Query().Get("account"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	n, err := notifierByName(acc.Notify, r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := n.Send(r.Context(), acc.Label()+"Test Notification - GradeChecker is working!"); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"gradechecker/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		err := db.InsertGrade(context.Background(), storedGrade{Account: "default", Module: "Mathematik I", Grade: "1,7",
+			Status: eventNew, UpdatedAt: "2026-07-02T10:00:00Z"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range []GradeEvent{
+			{Account: "default", Type: eventNew, Module: "Mathematik I", Grade: "#"},
+			{Account: "default", Type: eventChanged, Module: "Mathematik I", Grade: "1,7", PreviousGrade: "#"},
+		} {
+			if err := recordEvent(context.Background(), db, &e); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		srv := httptest.NewServer(newAPI(db, "secret", "1.2.3"))
+		defer srv.Close()
+
+		get := func(path, token string, v any) int {
+			req, _ := http.NewRequest("GET", srv.URL+path, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if v != nil {
+				if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+					t.Fatalf("%s: %v", path, err)
+				}
+			}
+			return resp.StatusCode
+		}
+
+		if code := get("/api/grades", "", nil); code != http.StatusUnauthorized {
+			t.Errorf("without token: status %d", code)
+		}
+		if code := get("/api/grades", "wrong", nil); code != http.StatusUnauthorized {
+			t.Errorf("wrong token: status %d", code)
+		}
+
+		var grades []storedGrade
+		if code := get("/api/grades", "secret", &grades); code != http.StatusOK || len(grades) != 1 {
+			t.Fatalf("grades: status %d, %+v", code, grades)
+		}
+
+		var history struct {
+			Grade  storedGrade
+			Events []GradeEvent
+		}
+		if code := get("/api/grades/"+strconv.FormatInt(grades[0].ID, 10)+"/history", "secret", &history); code != http.StatusOK {
+			t.Fatalf("history: status %d", code)
+		}
+		if len(history.Events) != 2 || history.Events[1].PreviousGrade != "#" {
+			t.Errorf("history events = %+v", history.Events)
+		}
+		if code := get("/api/grades/999/history", "secret", nil); code != http.StatusNotFound {
+			t.Errorf("unknown grade: status %d", code)
+		}
+
+		var stats gradeStats
+		if code := get("/api/stats", "secret", &stats); code != http.StatusOK {
+			t.Fatalf("stats: status %d", code)
+		}
+		if stats.Grades != 1 || stats.Average == nil || *stats.Average != 1.7 || stats.Events[eventChanged] != 1 {
+			t.Errorf("stats = %+v", stats)
+		}
+
+		req, _ := http.NewRequest("POST", srv.URL+"/api/check", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("check: status %d", resp.StatusCode)
+		}
+		select {
+		case <-checkRequests:
+		default:
+			t.Error("check was not requested")
+		}
+	})
+}
+
+func TestAPITestNotifier(t *testing.T) {
+	var sent []string
+	webhook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Content string }
+		json.NewDecoder(r.Body).Decode(&payload)
+		sent = append(sent, payload.Content)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+	defer func(orig http.RoundTripper) { http.DefaultClient.Transport = orig }(http.DefaultClient.Transport)
+	http.DefaultClient.Transport = webhook.Client().Transport
+
+	t.Cleanup(func() { current.Store(nil) })
+	env := map[string]string{
+		"ACCOUNTS":           "alice,bob",
+		"CIS_USERNAME_ALICE": "alice", "CIS_PASSWORD_ALICE": "a",
+		"CIS_USERNAME_BOB": "bob", "CIS_PASSWORD_BOB": "b",
+		"DISCORD_WEBHOOK_URL_ALICE": webhook.URL,
+		"DISCORD_WEBHOOK_URL_BOB":   webhook.URL,
+	}
+	cfg, err := config.Load("", func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Store(cfg)
+
+	srv := httptest.NewServer(newAPI(nil, "secret", ""))
+	defer srv.Close()
+	post := func(path string) int {
+		req, _ := http.NewRequest("POST", srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Without ?account= the first account's settings are used
+	if code := post("/api/notifiers/discord-webhook/test"); code != http.StatusOK {
+		t.Errorf("without account: status %d", code)
+	}
+	if code := post("/api/notifiers/discord-webhook/test?account=bob"); code != http.StatusOK {
+		t.Errorf("bob: status %d", code)
+	}
+	if code := post("/api/notifiers/discord-webhook/test?account=default"); code != http.StatusNotFound {
+		t.Errorf("unknown account: status %d", code)
+	}
+	if len(sent) != 2 || !strings.HasPrefix(sent[0], "[alice] ") || !strings.HasPrefix(sent[1], "[bob] ") {
+		t.Errorf("sent %q", sent)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"archive/tar"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupFormat is the version of the backup archive layout.
+const backupFormat = 1
+
+// A backup is a gzipped tar archive of
+//
+//	manifest.json        backupManifest, always the first entry
+//	grades.db            a consistent snapshot of the database
+//	transcripts/NAME     the downloaded transcripts, encrypted if the data is
+//	gradechecker.yaml    the configuration without its secrets
+const (
+	backupManifestName = "manifest.json"
+	backupDBName       = "grades.db"
+	backupConfigName   = "gradechecker.yaml"
+	backupTranscripts  = "transcripts/"
+)
+
+// backupManifest describes a backup.
+type backupManifest struct {
+	Format        int    `json:"format"`
+	Version       string `json:"version"`
+	SchemaVersion int    `json:"schema_version"`
+	CreatedAt     string `json:"created_at"`
+	// Encrypted is set if the grades are encrypted at rest; the key is not
+	// part of the backup.
+	Encrypted bool     `json:"encrypted"`
+	Files     []string `json:"files"`
+}
+
+// writeBackup writes a backup of the database, transcripts and
+// configuration. It can run while the bot is running: the database is
+// copied with VACUUM INTO, which reads a consistent snapshot.
+func writeBackup(w io.Writer) (backupManifest, error) {
+	m := backupManifest{Format: backupFormat, CreatedAt: now()}
+	m.Version, _ = readVersion()
+	if currentConfig().Database.URL != "" {
+		return m, errBackupPostgres
+	}
+
+	if _, err := os.Stat(dbFile); err != nil {
+		return m, err
+	}
+	dir, err := os.MkdirTemp("", "gradechecker-backup")
+	if err != nil {
+		return m, err
+	}
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, backupDBName)
+	if err := snapshotDB(snapshot, &m); err != nil {
+		return m, fmt.Errorf("copying the database: %w", err)
+	}
+
+	files := map[string]string{backupDBName: snapshot}
+	m.Files = append(m.Files, backupDBName)
+	for _, acc := range loadAccounts() {
+		name := backupTranscripts + filepath.Base(acc.PDFFile)
+		if _, err := os.Stat(acc.PDFFile); err == nil && files[name] == "" {
+			files[name] = acc.PDFFile
+			m.Files = append(m.Files, name)
+		}
+	}
+	cfg, err := currentConfig().WithoutSecrets().Marshal()
+	if err != nil {
+		return m, err
+	}
+	m.Files = append(m.Files, backupConfigName)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	if err := add(backupManifestName, manifest); err != nil {
+		return m, err
+	}
+	for _, name := range m.Files {
+		data := cfg
+		if name != backupConfigName {
+			if data, err = os.ReadFile(files[name]); err != nil {
+				return m, err
+			}
+		}
+		if err := add(name, data); err != nil {
+			return m, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	return m, gz.Close()
+}
+
+// errBackupPostgres is returned by backup and restore for a PostgreSQL
+// database, which has its own tools.
+var errBackupPostgres = errors.New("backup and restore only cover grades.db; back up a PostgreSQL database with pg_dump")
+
+// snapshotDB copies the database to path and records its schema version
+// and encryption in the manifest.
+func snapshotDB(path string, m *backupManifest) error {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	snapshot, err := openSQLite(path)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	if m.SchemaVersion, err = snapshot.SchemaVersion(ctx); err != nil {
+		return err
+	}
+	marker, err := readEncryptionMarker(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	m.Encrypted = marker != nil
+	// The lease of a running bot would lock out the restored one
+	_, err = snapshot.DeleteStatus(ctx, "leader")
+	return err
+}
+
+// restoreBackup replaces the database and transcripts with those of a
+// backup. The configuration is written to gradechecker.yaml if there is no
+// configuration file yet, else next to it as gradechecker.restored.yaml;
+// the name written is returned.
+//
+// Everything is extracted and checked before the first file is replaced.
+func restoreBackup(r io.Reader) (backupManifest, string, error) {
+	var m backupManifest
+	if currentConfig().Database.URL != "" {
+		return m, "", errBackupPostgres
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return m, "", fmt.Errorf("not a gradechecker backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != backupManifestName {
+		return m, "", errors.New("not a gradechecker backup: no manifest")
+	}
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return m, "", fmt.Errorf("invalid manifest: %w", err)
+	}
+	switch {
+	case m.Format != backupFormat:
+		return m, "", fmt.Errorf("backup format %d is not supported, update gradechecker", m.Format)
+	case m.SchemaVersion > schemaVersion:
+		return m, "", fmt.Errorf("the backup has schema version %d, this gradechecker supports up to %d; update it first",
+			m.SchemaVersion, schemaVersion)
+	}
+
+	// Extract into temporary files next to their targets
+	staged := make(map[string]string)
+	defer func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}()
+	configName, hasConfig := backupConfigName, false
+	if currentConfig().Path != "" {
+		configName = "gradechecker.restored.yaml"
+	} else if _, err := os.Stat(backupConfigName); err == nil {
+		configName = "gradechecker.restored.yaml"
+	}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return m, "", err
+		}
+		var target string
+		switch name := hdr.Name; {
+		case name == backupDBName:
+			target = dbFile
+		case name == backupConfigName:
+			target = configName
+			hasConfig = true
+		case strings.HasPrefix(name, backupTranscripts) && path.Base(name) == strings.TrimPrefix(name, backupTranscripts) &&
+			strings.EqualFold(path.Ext(name), ".pdf"):
+			target = path.Base(name)
+		default:
+			return m, "", fmt.Errorf("unexpected file %q in the backup", hdr.Name)
+		}
+		tmp := target + ".restore"
+		f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return m, "", err
+		}
+		staged[target] = tmp
+		_, err = io.Copy(f, tr)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return m, "", err
+		}
+	}
+	if staged[dbFile] == "" {
+		return m, "", errors.New("the backup contains no database")
+	}
+	if err := checkRestoredDB(staged[dbFile], m.SchemaVersion); err != nil {
+		return m, "", err
+	}
+
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(dbFile + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return m, "", err
+		}
+	}
+	for target, tmp := range staged {
+		if err := os.Rename(tmp, target); err != nil {
+			return m, "", err
+		}
+		delete(staged, target)
+	}
+	if !hasConfig {
+		configName = ""
+	}
+	return m, configName, nil
+}
+
+// checkRestoredDB verifies that an extracted database is intact and has
+// the schema version its manifest claims.
+func checkRestoredDB(path string, want int) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("the database in the backup is damaged: %w", err)
+	} else if result != "ok" {
+		return fmt.Errorf("the database in the backup is damaged: %s", result)
+	}
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version != want {
+		return fmt.Errorf("the database in the backup has schema version %d, the manifest says %d", version, want)
+	}
+	return nil
+}
+
+func cmdBackup(args []string) int {
+	fs := newFlagSet("backup")
+	output := fs.String("output", "", "archive to write (default gradechecker-backup-DATE-TIME.tar.gz)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	name := *output
+	if name == "" {
+		name = "gradechecker-backup-" + time.Now().Format("20060102-150405") + ".tar.gz"
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	m, err := writeBackup(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	fmt.Printf("Wrote %s (%d files, schema version %d).\n", name, len(m.Files), m.SchemaVersion)
+	fmt.Println("Secrets (passwords, tokens, webhook URLs) are not included; references to them are.")
+	if m.Encrypted {
+		fmt.Println("The grades are encrypted: keep the passphrase or key file, it is not included either.")
+	}
+	return exitOK
+}
+
+func cmdRestore(args []string) int {
+	fs := newFlagSet("restore")
+	force := fs.Bool("force", false, "replace a database that already holds grades")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer f.Close()
+
+	// The database must not be replaced under a running bot. The lock file
+	// keeps other instances out until the restore has finished.
+	if err := acquireLockFile(lockFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer os.Remove(lockFile)
+	if _, err := os.Stat(dbFile); err == nil && currentConfig().Database.URL == "" {
+		db, err := openSQLite(dbFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		// Counted without the key, which may not be configured yet
+		var grades int
+		db.queryRow(context.Background(), "SELECT COUNT(*) FROM grades_v2").Scan(&grades)
+		if grades > 0 && !*force {
+			db.Close()
+			fmt.Fprintf(os.Stderr, "%s already holds %d grades; use --force to replace it\n", dbFile, grades)
+			return exitError
+		}
+		// The lease catches a bot using the database through another
+		// path. The file is replaced below, so it must not stay open.
+		id := instanceID()
+		err = acquireLease(context.Background(), db, id, time.Now())
+		if err == nil {
+			err = db.ReleaseLease(context.Background(), id)
+		}
+		db.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+
+	m, configName, err := restoreBackup(f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Printf("Restored the backup of %s (gradechecker %s, schema version %d).\n", m.CreatedAt, cmp.Or(m.Version, "unknown"), m.SchemaVersion)
+	if configName != "" {
+		fmt.Printf("The configuration is in %s; set the secrets (passwords, tokens, webhook URLs) again.\n", configName)
+	}
+
+	// Migrate an older schema and check the encryption key, which may only
+	// be configured in the restored file
+	if configName == backupConfigName {
+		cfg, err := loadConfig()
+		if cfg == nil {
+			fmt.Fprintf(os.Stderr, "The data is restored, but %s cannot be read: %v\n", configName, err)
+			return exitError
+		}
+		current.Store(cfg)
+	}
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "The data is restored, but cannot be opened yet: %v\n", err)
+		if m.Encrypted {
+			fmt.Fprintln(os.Stderr, "Configure the passphrase or key file the grades were encrypted with.")
+		}
+		return exitError
+	}
+	db.Close()
+	return exitOK
+}
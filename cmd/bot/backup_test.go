@@ -0,0 +1,152 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"gradechecker/pkg/config"
+	"gradechecker/pkg/crypt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() { current.Store(nil) })
+	cfg, err := config.Load("", func(key string) string {
+		return map[string]string{"CIS_USERNAME": "alice", "CIS_PASSWORD": "hunter2"}[key]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Store(cfg)
+
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	err = db.InsertGrade(ctx, storedGrade{Account: "default", Module: "Mathematik I", Grade: "1,7", Status: eventNew, UpdatedAt: "2026-07-02T10:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetStatus(ctx, "leader", "other-host:1"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := os.WriteFile("grades.pdf", []byte("%PDF-1.4 transcript"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	m, err := writeBackup(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SchemaVersion != schemaVersion || len(m.Files) != 3 {
+		t.Errorf("manifest = %+v", m)
+	}
+	if bytes.Contains(archive.Bytes(), []byte("hunter2")) {
+		t.Error("the backup contains the password")
+	}
+
+	// Restore on a fresh machine
+	for _, name := range []string{"grades.db", "grades.pdf"} {
+		os.Remove(name)
+	}
+	_, configName, err := restoreBackup(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(configName); err != nil || !strings.Contains(string(data), "username: alice") {
+		t.Errorf("restored %s: %q, %v", configName, data, err)
+	}
+	if data, err := os.ReadFile("grades.pdf"); err != nil || string(data) != "%PDF-1.4 transcript" {
+		t.Errorf("restored transcript: %q, %v", data, err)
+	}
+	db, err = openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	grades, err := db.Grades(ctx, "", "")
+	if err != nil || len(grades) != 1 || grades[0].Grade != "1,7" {
+		t.Errorf("restored grades = %+v, %v", grades, err)
+	}
+	inst, err := acquireInstance(db)
+	if err != nil {
+		t.Fatalf("the lease of the backed up bot was restored: %v", err)
+	}
+	inst.Release()
+}
+
+func TestRestoreEncrypted(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() {
+		current.Store(nil)
+		atRest = nil
+	})
+	useConfig := func(env map[string]string) {
+		cfg, err := config.Load("", func(key string) string { return env[key] })
+		if err != nil {
+			t.Fatal(err)
+		}
+		current.Store(cfg)
+	}
+	if err := os.WriteFile("gradechecker.key", crypt.NewKeyFile(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	useConfig(map[string]string{"CIS_USERNAME": "alice", "CIS_PASSWORD": "hunter2", "ENCRYPTION_KEY_FILE": "gradechecker.key"})
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.InsertGrade(context.Background(), storedGrade{Account: "default", Module: "Mathematik I", Grade: "1,7", Status: eventNew})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create("backup.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = writeBackup(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore on a fresh machine that only has the key file
+	os.Remove(dbFile)
+	useConfig(nil)
+	atRest = nil
+	if code := cmdRestore([]string{"backup.tar.gz"}); code != exitOK {
+		t.Fatalf("restore exited with %d", code)
+	}
+	if cfg := currentConfig(); cfg.Path != backupConfigName || cfg.Encryption.KeyFile != "gradechecker.key" {
+		t.Errorf("configuration after the restore = %+v", cfg)
+	}
+	if _, err := os.Stat(lockFile); err == nil {
+		t.Error("the lock file is left behind")
+	}
+}
+
+func TestRestoreRejectsNewerSchema(t *testing.T) {
+	t.Chdir(t.TempDir())
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	manifest := fmt.Sprintf(`{"format": 1, "schema_version": %d}`, schemaVersion+1)
+	tw.WriteHeader(&tar.Header{Name: backupManifestName, Mode: 0600, Size: int64(len(manifest))})
+	tw.Write([]byte(manifest))
+	tw.Close()
+	gz.Close()
+
+	_, _, err := restoreBackup(&archive)
+	if err == nil || !strings.Contains(err.Error(), "update it first") {
+		t.Errorf("restoreBackup = %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gradechecker/pkg/config"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Failure classes of a check cycle. Errors returned by checkGrades wrap one
+// of them so callers can tell a login problem from a network or parser one.
+var (
+	errAuth    = errors.New("authentication failed")
+	errNetwork = errors.New("network error")
+	errParse   = errors.New("parse error")
+	errConfig  = errors.New("configuration error")
+)
+
+// errorKind returns a short name for the failure class of err.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, errAuth):
+		return "auth"
+	case errors.Is(err, errNetwork):
+		return "network"
+	case errors.Is(err, errParse):
+		return "parse"
+	case errors.Is(err, errConfig):
+		return "config"
+	default:
+		return "error"
+	}
+}
+
+// Grade event types.
+const (
+	eventNew     = "new"
+	eventChanged = "changed"
+	eventRemoved = "removed"
+)
+
+// GradeEvent is a difference between the stored grades and a new transcript.
+type GradeEvent struct {
+	Account         string `json:"account"`
+	Type            string `json:"type"`
+	Module          string `json:"module"`
+	OccurrenceIndex int    `json:"occurrence_index"`
+	Grade           string `json:"grade,omitempty"`
+	PreviousGrade   string `json:"previous_grade,omitempty"`
+	// Silent is set for grades added by the initial sync of an account,
+	// which does not send notifications.
+	Silent bool   `json:"silent,omitempty"`
+	Time   string `json:"time,omitempty"`
+	// RecordedModule is the module name when the event was recorded, which
+	// stays the same when the module is renamed or merged. It is only set
+	// on events read from the store.
+	RecordedModule string `json:"-"`
+}
+
+// recordEvent appends an event to the grade history and sets its time.
+func recordEvent(ctx context.Context, db Store, e *GradeEvent) error {
+	e.Time = now()
+	return db.AddEvent(ctx, *e)
+}
+
+// cycleResult is the outcome of one check cycle of an account.
+type cycleResult struct {
+	Account string
+	Events  []GradeEvent
+	Err     error
+}
+
+// runCycle checks every account once and then sends the queued
+// notifications. Accounts not started before ctx is cancelled are skipped.
+// Accounts without a successful check for too long get a watchdog alert.
+func runCycle(ctx context.Context, db Store, clients sessions, accounts []Account) []cycleResult {
+	var results []cycleResult
+	for _, acc := range accounts {
+		if ctx.Err() != nil {
+			break
+		}
+		events, err := runAccount(ctx, db, clients, acc)
+		if err != nil {
+			slog.Error("Check failed", "account", acc.Name, "kind", errorKind(err), "err", err)
+		}
+		results = append(results, cycleResult{Account: acc.Name, Events: events, Err: err})
+	}
+	watchdog(ctx, db, accounts)
+	dispatchOutbox(ctx, db)
+	return results
+}
+
+// runAccount performs one check cycle for a single account.
+// Errors and panics are contained so one broken account never blocks the others.
+func runAccount(ctx context.Context, db Store, clients sessions, acc Account) (events []GradeEvent, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("check cycle panicked: %v", r)
+		}
+	}()
+
+	if acc.Username == "" || acc.Password == "" {
+		if acc.Name == defaultAccount {
+			return nil, fmt.Errorf("%w: CIS_USERNAME and CIS_PASSWORD must be set in .env or the config file", errConfig)
+		}
+		return nil, fmt.Errorf("%w: CIS_USERNAME_%s and CIS_PASSWORD_%s must be set in .env or the config file",
+			errConfig, config.EnvSuffix(acc.Name), config.EnvSuffix(acc.Name))
+	}
+
+	client, err := clients.client(acc.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+
+	if err := health.allow(acc.Name, time.Now()); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if ctx.Err() == nil {
+			health.record(acc.Name, err, time.Now())
+		}
+	}()
+
+	slog.Info("Starting check cycle", "account", acc.Name)
+	bus.Publish(busCheckStarted, map[string]string{"account": acc.Name})
+	defer func() {
+		finished := map[string]any{"account": acc.Name, "changes": len(events)}
+		result := "success"
+		if err != nil {
+			result = errorKind(err)
+			finished["error"], finished["kind"] = err.Error(), result
+		}
+		checkCycles.Inc(acc.Name, result)
+		bus.Publish(busCheckFinished, finished)
+	}()
+	return checkGrades(ctx, db, client, acc)
+}
+
+// checkGrades downloads the transcript of an account, stores the differences
+// to the database and queues notifications for them. It returns the
+// differences found. Everything is stored in a single transaction, which is
+// rolled back if ctx is cancelled or storing fails.
+func checkGrades(ctx context.Context, db Store, client *http.Client, acc Account) ([]GradeEvent, error) {
+	logger := slog.With("account", acc.Name)
+
+	newGrades, err := fetchGrades(ctx, client, acc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the stored grades of this account
+	stored, err := db.Grades(ctx, acc.Name, "")
+	if err != nil {
+		return nil, fmt.Errorf("loading stored grades: %w", err)
+	}
+	existing := make(map[Grade]storedGrade)
+	var modules []string
+	for _, g := range stored {
+		existing[Grade{Module: g.Module, OccurrenceIndex: g.OccurrenceIndex}] = g
+		modules = append(modules, g.Module)
+	}
+
+	// Refuse to apply snapshots that look like a parser failure
+	if problems := checkSnapshot(len(existing), newGrades); len(problems) > 0 {
+		rejectSnapshot(ctx, db, acc, newGrades, problems)
+		return nil, fmt.Errorf("%w: suspicious parser output: %v", errParse, problems)
+	}
+	logger.Info("Checking grades against database", "count", len(newGrades))
+
+	// Check if DB is empty for this account (First Run)
+	isFirstRun := len(existing) == 0
+	if isFirstRun {
+		logger.Info("Database is empty, performing initial silent sync")
+	}
+
+	var events []GradeEvent
+	err = db.Tx(ctx, func(tx Store) error {
+		if err := clearParserAlert(ctx, tx, acc); err != nil {
+			return err
+		}
+		if err := clearWatchdogAlert(ctx, tx, acc); err != nil {
+			return err
+		}
+		newGrades, err := resolveModules(ctx, tx, newGrades, modules)
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[Grade]bool)
+		for _, g := range newGrades {
+			key := Grade{Module: g.Module, OccurrenceIndex: g.OccurrenceIndex}
+			seen[key] = true
+			current, exists := existing[key]
+
+			switch {
+			case !exists:
+				// New grade entry
+				if !isFirstRun {
+					logger.Info("New grade found", "module", g.Module, "grade", g.Grade)
+					if g.Grade != "#" {
+						if err := enqueueNotification(ctx, tx, acc, gradeMessage(acc.Label()+g.Module, g.Grade)); err != nil {
+							return err
+						}
+					} else {
+						logger.Info("Skipping notification for placeholder grade '#'", "module", g.Module)
+					}
+				} else {
+					logger.Info("Silently adding initial grade", "module", g.Module, "grade", g.Grade)
+				}
+
+				err := tx.InsertGrade(ctx, storedGrade{Account: acc.Name, Module: g.Module, Grade: g.Grade,
+					OccurrenceIndex: g.OccurrenceIndex, Status: eventNew, UpdatedAt: now()})
+				if err != nil {
+					return err
+				}
+				events = append(events, GradeEvent{Account: acc.Name, Type: eventNew, Module: g.Module,
+					OccurrenceIndex: g.OccurrenceIndex, Grade: g.Grade, Silent: isFirstRun})
+
+			case current.Status == eventRemoved:
+				// A grade that had disappeared from the transcript is back
+				logger.Info("Grade reappeared", "module", g.Module, "grade", g.Grade)
+				current.Grade, current.Status, current.UpdatedAt = g.Grade, eventNew, now()
+				if err := tx.UpdateGrade(ctx, current); err != nil {
+					return err
+				}
+				events = append(events, GradeEvent{Account: acc.Name, Type: eventNew, Module: g.Module,
+					OccurrenceIndex: g.OccurrenceIndex, Grade: g.Grade})
+
+			case current.Grade != g.Grade:
+				// Grade changed
+				logger.Info("Grade updated", "module", g.Module, "previous", current.Grade, "grade", g.Grade)
+				previous := current.Grade
+				current.Grade, current.UpdatedAt = g.Grade, now()
+				if err := tx.UpdateGrade(ctx, current); err != nil {
+					return err
+				}
+
+				if err := enqueueNotification(ctx, tx, acc, gradeMessage(acc.Label()+g.Module, g.Grade)); err != nil {
+					return err
+				}
+				events = append(events, GradeEvent{Account: acc.Name, Type: eventChanged, Module: g.Module,
+					OccurrenceIndex: g.OccurrenceIndex, Grade: g.Grade, PreviousGrade: previous})
+			}
+		}
+
+		// Grades no longer on the transcript are kept but marked as removed
+		for key, current := range existing {
+			if seen[key] || current.Status == eventRemoved {
+				continue
+			}
+			logger.Info("Grade no longer on transcript", "module", key.Module, "grade", current.Grade)
+			current.Status, current.UpdatedAt = eventRemoved, now()
+			if err := tx.UpdateGrade(ctx, current); err != nil {
+				return err
+			}
+			events = append(events, GradeEvent{Account: acc.Name, Type: eventRemoved, Module: key.Module,
+				OccurrenceIndex: key.OccurrenceIndex, PreviousGrade: current.Grade})
+		}
+
+		// Keep the history of every grade
+		for i := range events {
+			if err := recordEvent(ctx, tx, &events[i]); err != nil {
+				return err
+			}
+		}
+
+		// Update last check time, globally for the dashboard and per account
+		if err := tx.SetStatus(ctx, "last_check", now()); err != nil {
+			return err
+		}
+		return tx.SetStatus(ctx, "last_check:"+acc.Name, now())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storing grades: %w", err)
+	}
+	if isFirstRun {
+		logger.Info("Initial silent sync complete, notifications are enabled for future runs")
+	}
+	for _, e := range events {
+		gradeEvents.Inc(e.Type)
+		bus.Publish(busGrade, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestResultCode(t *testing.T) {
+	changed := cycleResult{Account: "a", Events: []GradeEvent{{Type: eventNew}}}
+	tests := []struct {
+		name    string
+		results []cycleResult
+		want    int
+	}{
+		{"nothing", []cycleResult{{Account: "a"}}, exitOK},
+		{"changes", []cycleResult{changed}, exitChanges},
+		{"parse", []cycleResult{changed, {Err: fmt.Errorf("%w: bad", errParse)}}, exitParse},
+		{"auth wins", []cycleResult{
+			{Err: fmt.Errorf("%w: timeout", errNetwork)},
+			{Err: fmt.Errorf("login failed: %w", fmt.Errorf("%w: wrong password", errAuth))},
+		}, exitAuth},
+		{"other", []cycleResult{changed, {Err: errors.New("disk full")}}, exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resultCode(tt.results); got != tt.want {
+				t.Errorf("resultCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gradechecker/pkg/config"
+	"gradechecker/pkg/crypt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+)
+
+// Exit codes shared by all commands. check --once additionally reports
+// what it found with exitChanges and the failure specific codes.
+const (
+	exitOK      = 0
+	exitError   = 1
+	exitUsage   = 2
+	exitChanges = 3
+	exitAuth    = 4
+	exitNetwork = 5
+	exitParse   = 6
+)
+
+// command is a gradechecker subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	// Assigned in init because the help command refers to the list itself.
+	commands = []command{
+		{"run", "[--account NAME]", "Start the bot and check for new grades periodically", cmdRun},
+		{"check", "[--once [--format text|json|ndjson]] [--account NAME]", "Check for new grades without the startup tasks of run", cmdCheck},
+		{"list", "[--account NAME]", "List the stored grades", cmdList},
+		{"show", "[--account NAME] MODULE", "Show all attempts of the modules matching MODULE", cmdShow},
+		{"modules", "[--json] | edit [--name NAME] [--credits CP] [--semester N] ID | merge [--dry-run] [INTO FROM...]", "List the module catalog, edit a module or merge duplicate modules", cmdModules},
+		{"import", "[--account NAME] [--dry-run] DIR", "Rebuild the grade history from the transcript PDFs in DIR", cmdImport},
+		{"export", "[--format csv|json|ics] [--account NAME] [--output FILE]", "Export the grades and their history", cmdExport},
+		{"test-notify", "[--backend NAME] [--account NAME]", "Send a test notification", cmdTestNotify},
+		{"parse", "[--raw] [--json] FILE", "Parse a transcript PDF (or HTML/text) file and print the grades", cmdParse},
+		{"login", "[--verify] [--account NAME]", "Log in to CIS to test the credentials", cmdLogin},
+		{"doctor", "[--offline] [--account NAME]", "Diagnose configuration, connectivity and parser problems", cmdDoctor},
+		{"config", "validate [FILE]", "Check the configuration file and environment and report every invalid value", cmdConfig},
+		{"secret", "set keyring:SERVICE/USER", "Store a secret read from stdin in the OS keyring", cmdSecret},
+		{"backup", "[--output FILE]", "Write the database, transcripts and configuration (without secrets) to an archive", cmdBackup},
+		{"restore", "[--force] ARCHIVE", "Restore a backup written by backup", cmdRestore},
+		{"rekey", "--passphrase REF|- | --key-file PATH | --decrypt", "Re-encrypt the grades and transcripts with a new key, or decrypt them", cmdRekey},
+		{"version", "", "Print the version", cmdVersion},
+		{"help", "[COMMAND]", "Show help for a command", cmdHelp},
+	}
+}
+
+// runCLI sets up logging, dispatches to a subcommand and returns the
+// process exit code. Without arguments the bot runs, which is how the
+// dashboard starts it.
+func runCLI(args []string) int {
+	godotenv.Load()
+	name := "run"
+	if len(args) > 0 {
+		name = args[0]
+		args = args[1:]
+	}
+	switch name {
+	case "--test": // used by older dashboards
+		name = "test-notify"
+	case "-h", "--help":
+		name = "help"
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "gradechecker: unknown command %q\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	cfg, cfgErr := loadConfig()
+	if cfg == nil {
+		cfg = config.Default()
+	}
+	current.Store(cfg)
+	closeLog := setupLogging(cfg.Log)
+	defer closeLog()
+
+	// These commands work without a valid configuration; config and
+	// doctor report the problems themselves.
+	switch name {
+	case "help", "version", "parse", "config", "doctor", "secret":
+	default:
+		if cfgErr != nil {
+			fmt.Fprintf(os.Stderr, "gradechecker: invalid configuration:\n%v\n\nRun \"gradechecker config validate\" after fixing it.\n", cfgErr)
+			return exitUsage
+		}
+		logConfigWarnings(cfg)
+	}
+
+	return cmd.run(args)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: gradechecker <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "gradechecker help <command>" for the flags of a command.`)
+}
+
+// newFlagSet creates the flag set of a command with a matching usage text.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, c := range commands {
+			if c.name == name {
+				fmt.Fprintf(fs.Output(), "Usage: gradechecker %s %s\n\n%s\n", c.name, c.args, c.summary)
+			}
+		}
+		var hasFlags bool
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(fs.Output(), "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseFlags parses args and reports the exit code to use if parsing failed.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+func cmdRun(args []string) int {
+	fs := newFlagSet("run")
+	account := fs.String("account", "", "only check this account")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	return runDaemon(*account)
+}
+
+func cmdCheck(args []string) int {
+	fs := newFlagSet("check")
+	once := fs.Bool("once", false, "run a single check cycle, print the changes and exit with\n"+
+		"0 (no changes), 3 (changes), 4 (login failed), 5 (network error) or 6 (parse error)")
+	format := fs.String("format", "text", "output format of --once: text, json or ndjson")
+	account := fs.String("account", "", "only check this account")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *format != "text" && *format != "json" && *format != "ndjson" {
+		fmt.Fprintf(os.Stderr, "invalid --format %q\n", *format)
+		return exitUsage
+	}
+
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Cannot open the database", "err", err)
+		return exitError
+	}
+	defer db.Close()
+
+	inst, err := acquireInstance(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer inst.Release()
+
+	if !*once {
+		return checkLoop(db, *account, inst.Lost())
+	}
+
+	accounts, err := selectAccounts(*account)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results := runCycle(ctx, db, sessions{}, accounts)
+	if err := printResults(os.Stdout, results, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return resultCode(results)
+}
+
+// checkError is a failed account in the output of check --once.
+type checkError struct {
+	Account string `json:"account"`
+	Kind    string `json:"kind"`
+	Error   string `json:"error"`
+}
+
+// printResults writes the outcome of a check cycle in the given format.
+func printResults(w io.Writer, results []cycleResult, format string) error {
+	events := []GradeEvent{}
+	errs := []checkError{}
+	for _, r := range results {
+		events = append(events, r.Events...)
+		if r.Err != nil {
+			errs = append(errs, checkError{r.Account, errorKind(r.Err), r.Err.Error()})
+		}
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Changes []GradeEvent `json:"changes"`
+			Errors  []checkError `json:"errors"`
+		}{events, errs})
+
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		for _, e := range errs {
+			if err := enc.Encode(struct {
+				Type string `json:"type"`
+				checkError
+			}{"error", e}); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, e := range events {
+			grade := e.Grade
+			if e.Type == eventChanged {
+				grade = e.PreviousGrade + " -> " + e.Grade
+			} else if e.Type == eventRemoved {
+				grade = e.PreviousGrade
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", e.Account, e.Type, e.OccurrenceIndex+1, e.Module, grade)
+		}
+		for _, e := range errs {
+			fmt.Fprintf(tw, "%s\terror\t\t%s\t%s\n", e.Account, e.Kind, e.Error)
+		}
+		return tw.Flush()
+	}
+}
+
+// resultCode maps the outcome of a check cycle to the exit code of check --once.
+// Failures take precedence over changes; the most fundamental failure wins.
+func resultCode(results []cycleResult) int {
+	code := exitOK
+	rank := map[int]int{exitOK: 0, exitChanges: 1, exitError: 2, exitParse: 3, exitNetwork: 4, exitAuth: 5}
+	for _, r := range results {
+		c := exitOK
+		switch {
+		case r.Err != nil:
+			switch errorKind(r.Err) {
+			case "auth":
+				c = exitAuth
+			case "network":
+				c = exitNetwork
+			case "parse":
+				c = exitParse
+			default:
+				c = exitError
+			}
+		case len(r.Events) > 0:
+			c = exitChanges
+		}
+		if rank[c] > rank[code] {
+			code = c
+		}
+	}
+	return code
+}
+
+// storedGrade is a grade row as stored in the database.
+type storedGrade struct {
+	ID              int64  `json:"id"`
+	Account         string `json:"account"`
+	ModuleID        int64  `json:"module_id"`
+	Module          string `json:"module"`
+	Grade           string `json:"grade"`
+	OccurrenceIndex int    `json:"occurrence_index"`
+	Status          string `json:"status"`
+	UpdatedAt       string `json:"updated_at"`
+}
+
+func printGrades(grades []storedGrade, withStatus bool) {
+	multi := false
+	for _, g := range grades {
+		multi = multi || g.Account != grades[0].Account
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "MODULE\tATTEMPT\tGRADE\tUPDATED"
+	if withStatus {
+		header += "\tSTATUS"
+	}
+	if multi {
+		header = "ACCOUNT\t" + header
+	}
+	fmt.Fprintln(tw, header)
+	for _, g := range grades {
+		line := fmt.Sprintf("%s\t%d\t%s\t%s", g.Module, g.OccurrenceIndex+1, g.Grade, g.UpdatedAt)
+		if withStatus {
+			line += "\t" + g.Status
+		}
+		if multi {
+			line = g.Account + "\t" + line
+		}
+		fmt.Fprintln(tw, line)
+	}
+	tw.Flush()
+}
+
+func cmdList(args []string) int {
+	fs := newFlagSet("list")
+	account := fs.String("account", "", "only list grades of this account")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer db.Close()
+
+	grades, err := db.Grades(context.Background(), *account, "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if len(grades) == 0 {
+		fmt.Fprintln(os.Stderr, "No grades stored yet.")
+		return exitOK
+	}
+	printGrades(grades, false)
+	return exitOK
+}
+
+func cmdShow(args []string) int {
+	fs := newFlagSet("show")
+	account := fs.String("account", "", "only search grades of this account")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer db.Close()
+
+	grades, err := db.Grades(context.Background(), *account, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if len(grades) == 0 {
+		fmt.Fprintf(os.Stderr, "No module matching %q.\n", fs.Arg(0))
+		return exitError
+	}
+	printGrades(grades, true)
+	return exitOK
+}
+
+func cmdTestNotify(args []string) int {
+	fs := newFlagSet("test-notify")
+	backend := fs.String("backend", "", "only use this backend ("+strings.Join(backendNames, ", ")+"), even if disabled")
+	account := fs.String("account", "", "use the notification settings of this account (default: the first one)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	acc, err := notifyAccount(*account)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	ns := acc.Notify
+	msg := acc.Label() + "Test Notification - GradeChecker is working!"
+
+	var n Notifier
+	if *backend != "" {
+		if n, err = notifierByName(ns, *backend); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+	}
+
+	slog.Info("Sending test notification")
+	switch {
+	case n != nil:
+		err = n.Send(context.Background(), msg)
+	case len(notifiers(ns)) == 0:
+		err = errors.New("no notification backend is enabled")
+	default:
+		err = notifyMessage(context.Background(), ns, msg)
+	}
+	if err != nil {
+		slog.Error("Test failed", "err", err)
+		return exitError
+	}
+	slog.Info("Test notification sent")
+	return exitOK
+}
+
+// parseFile parses a transcript file with the parser matching its type.
+func parseFile(path string) ([]Grade, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return parsePdf(path, "")
+	case ".html", ".htm":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return extractGradesHTML(f)
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return extractGrades(string(data)), nil
+	}
+}
+
+func cmdParse(args []string) int {
+	fs := newFlagSet("parse")
+	raw := fs.Bool("raw", false, "also print the plain text of the PDF")
+	asJSON := fs.Bool("json", false, "print the grades as JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	path := fs.Arg(0)
+	if data, err := os.ReadFile(path); err == nil && crypt.IsSealedFile(data) {
+		// An encrypted transcript needs the key, which is checked against the database
+		db, err := openDB()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		db.Close()
+	}
+
+	if *raw && strings.EqualFold(filepath.Ext(path), ".pdf") {
+		content, err := readPdf(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		fmt.Println("--- START PDF CONTENT ---")
+		fmt.Println(content)
+		fmt.Println("--- END PDF CONTENT ---")
+	}
+
+	grades, err := parseFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(grades); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	fmt.Printf("Found %d grades:\n", len(grades))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tATTEMPT\tGRADE")
+	for _, g := range grades {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", g.Module, g.OccurrenceIndex+1, g.Grade)
+	}
+	tw.Flush()
+	for _, p := range checkSnapshot(0, grades) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", p)
+	}
+	return exitOK
+}
+
+func cmdLogin(args []string) int {
+	fs := newFlagSet("login")
+	verify := fs.Bool("verify", false, "also check that the transcript can be downloaded")
+	account := fs.String("account", "", "only log in this account")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	accounts, err := selectAccounts(*account)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	code := exitOK
+	for _, acc := range accounts {
+		if err := verifyLogin(acc, *verify); err != nil {
+			slog.Error("Login check failed", "account", acc.Name, "err", err)
+			code = exitError
+			continue
+		}
+		slog.Info("Login OK", "account", acc.Name)
+	}
+	return code
+}
+
+// verifyLogin logs in with a fresh session. With transcript it also checks
+// that the transcript URL now returns a PDF.
+func verifyLogin(acc Account, transcript bool) error {
+	if acc.Username == "" || acc.Password == "" {
+		return errors.New("username or password not set")
+	}
+	client, err := sessions{}.client(acc.Name)
+	if err != nil {
+		return err
+	}
+	if err := performLogin(context.Background(), client, acc.Username, acc.Password); err != nil {
+		return err
+	}
+	if !transcript {
+		return nil
+	}
+
+	resp, err := client.Get(acc.TranscriptURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("transcript download failed, status: %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "application/pdf") {
+		return fmt.Errorf("transcript URL returned %q instead of a PDF (wrong credentials or TRANSCRIPT_URL?)", ct)
+	}
+	return nil
+}
+
+func cmdVersion(args []string) int {
+	fs := newFlagSet("version")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	version, err := readVersion()
+	if err != nil {
+		version = "unknown"
+	}
+	fmt.Printf("gradechecker %s\n", version)
+	return exitOK
+}
+
+func cmdHelp(args []string) int {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	for _, c := range commands {
+		if c.name == args[0] && c.name != "help" {
+			// Every command prints its usage for -h.
+			return c.run([]string{"-h"})
+		}
+	}
+	if args[0] == "help" {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "gradechecker: unknown command %q\n", args[0])
+	return exitUsage
+}
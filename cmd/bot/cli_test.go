@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCIS answers the requests of a check in place of the CIS. Without a
+// login the transcript URL serves the login page, like the real one does.
+type fakeCIS struct {
+	mu         sync.Mutex
+	down       bool
+	password   string
+	transcript []byte
+	loggedIn   bool
+}
+
+const fakeLoginPage = `<html><body><form action="/login" method="post"><input name="user"><input name="pass" type="password"></form></body></html>`
+
+func (f *fakeCIS) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	respond := func(contentType string, body []byte) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {contentType}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    r,
+		}, nil
+	}
+	switch {
+	case r.Method == http.MethodPost:
+		r.ParseForm()
+		if r.PostForm.Get("pass") != f.password {
+			return respond("text/html", []byte("<p>Anmeldefehler</p>"))
+		}
+		f.loggedIn = true
+		return respond("text/html", []byte(`<a href="/logout">Logout</a>`))
+	case r.URL.String() == loginURL || !f.loggedIn:
+		return respond("text/html", []byte(fakeLoginPage))
+	default:
+		return respond("application/pdf", f.transcript)
+	}
+}
+
+func TestRunCLIExitCodes(t *testing.T) {
+	transcript, err := os.ReadFile("testdata/transcripts/simple.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		cis  *fakeCIS
+		want int
+	}{
+		{"version", []string{"version"}, nil, &fakeCIS{}, exitOK},
+		{"unknown command", []string{"grades"}, nil, &fakeCIS{}, exitUsage},
+		{"unknown flag", []string{"check", "--bogus"}, nil, &fakeCIS{}, exitUsage},
+		{"invalid config", []string{"check", "--once"}, map[string]string{"CHECK_INTERVAL": "soon"}, &fakeCIS{}, exitUsage},
+		{"no credentials", []string{"check", "--once"}, nil, &fakeCIS{}, exitError},
+		{"changes", []string{"check", "--once"}, nil, &fakeCIS{password: "secret", transcript: transcript}, exitChanges},
+		{"wrong password", []string{"check", "--once"}, nil, &fakeCIS{password: "other", transcript: transcript}, exitAuth},
+		{"network", []string{"check", "--once"}, nil, &fakeCIS{down: true}, exitNetwork},
+		{"parse", []string{"check", "--once"}, nil, &fakeCIS{password: "secret", transcript: []byte("%PDF-1.4 garbage")}, exitParse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Cleanup(func() { current.Store(nil) })
+			defer func(orig *slog.Logger) { slog.SetDefault(orig) }(slog.Default())
+			defer func(orig http.RoundTripper) { http.DefaultTransport = orig }(http.DefaultTransport)
+			http.DefaultTransport = tt.cis
+
+			env := map[string]string{"CHECK_INTERVAL": "", "ACCOUNTS": "", "CIS_USERNAME": "", "CIS_PASSWORD": ""}
+			if tt.cis.password != "" || tt.cis.down {
+				env["CIS_USERNAME"] = "alice"
+				env["CIS_PASSWORD"] = "secret"
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+
+			if got := runCLI(tt.args); got != tt.want {
+				t.Errorf("runCLI(%q) = %d, want %d", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
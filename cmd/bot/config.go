@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"gradechecker/pkg/config"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// configPollInterval is how often the configuration file and .env are
+// checked for changes; a change reloads the configuration like SIGHUP.
+const configPollInterval = 5 * time.Second
+
+// current is the active configuration, replaced on reload.
+var current atomic.Pointer[config.Config]
+
+// currentConfig returns the active configuration. Before one was loaded
+// (as in tests) it is read from the environment alone.
+func currentConfig() *config.Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	cfg, _ := config.Load("", os.Getenv)
+	return cfg
+}
+
+// loadConfig reads the configuration file (see config.Find) and the
+// environment. Besides the checks of the config package it parses the
+// schedule. On invalid values both the configuration and config.Errors are
+// returned; a file that cannot be read returns no configuration.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(config.Find(os.Getenv), os.Getenv)
+	if cfg == nil {
+		return nil, err
+	}
+	var errs config.Errors
+	errors.As(err, &errs)
+	if _, err := loadSchedule(cfg); err != nil {
+		var fe *config.FieldError
+		if errors.As(err, &fe) {
+			errs = append(errs, fe)
+		}
+	}
+	for _, s := range cfg.Secrets() {
+		secrets.add(s)
+	}
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+	return cfg, nil
+}
+
+// logConfigWarnings logs the values that are used, but likely not as meant.
+func logConfigWarnings(cfg *config.Config) {
+	for _, w := range cfg.Warnings() {
+		slog.Warn("Check the configuration", "warning", w.Error())
+	}
+}
+
+// resolveSecret returns the secret a configured value stands for (see
+// config.Resolve) and registers it for redaction. Call it right before
+// the secret is used; the result must not be stored.
+func resolveSecret(ctx context.Context, value string) (string, error) {
+	secret, err := config.Resolve(ctx, value)
+	if err != nil {
+		return "", err
+	}
+	secrets.add(secret)
+	return secret, nil
+}
+
+// reloadConfig rereads .env and the configuration file and logs what
+// changed. An invalid configuration is logged and the previous one kept.
+// It reports whether the configuration changed.
+func reloadConfig() bool {
+	godotenv.Overload()
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.Error("Invalid configuration, keeping the previous one", "err", err)
+		return false
+	}
+	logConfigWarnings(cfg)
+	old := currentConfig()
+	changes := config.Diff(old, cfg)
+	if len(changes) == 0 {
+		slog.Info("Configuration reloaded, nothing changed")
+		return false
+	}
+	for _, change := range changes {
+		slog.Info("Configuration changed", "change", change)
+	}
+	current.Store(cfg)
+	reloadLogging(cfg)
+	if old.API != cfg.API || old.Log.Format != cfg.Log.Format || old.Log.File != cfg.Log.File ||
+		old.Log.MaxSize != cfg.Log.MaxSize || old.Log.MaxBackups != cfg.Log.MaxBackups {
+		slog.Warn("Changes to the API, the log format and the log file take effect on restart")
+	}
+	if old.Encryption != cfg.Encryption {
+		slog.Warn("Changes to the encryption take effect on restart; change the key with gradechecker rekey")
+	}
+	return true
+}
+
+// watchConfig reports changes of the configuration file and .env on the
+// returned channel by polling their modification time.
+func watchConfig(done <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	modTimes := func() (out [2]time.Time) {
+		for i, path := range []string{config.Find(os.Getenv), ".env"} {
+			if info, err := os.Stat(path); path != "" && err == nil {
+				out[i] = info.ModTime()
+			}
+		}
+		return out
+	}
+	go func() {
+		last := modTimes()
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if now := modTimes(); now != last {
+					last = now
+					select {
+					case changed <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return changed
+}
+
+func cmdConfig(args []string) int {
+	fs := newFlagSet("config")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() < 1 || fs.Arg(0) != "validate" || fs.NArg() > 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	if fs.NArg() == 2 {
+		os.Setenv("CONFIG_FILE", fs.Arg(1))
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		var errs config.Errors
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				fmt.Fprintln(os.Stderr, e)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return exitError
+	}
+	for _, w := range cfg.Warnings() {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	source := "environment only"
+	if cfg.Path != "" {
+		source = cfg.Path + " and the environment"
+	}
+	names := make([]string, len(cfg.Accounts))
+	for i, acc := range cfg.Accounts {
+		names[i] = acc.Name
+	}
+	fmt.Printf("Configuration is valid (%s), accounts: %s\n", source, strings.Join(names, ", "))
+	return exitOK
+}
+
+func cmdSecret(args []string) int {
+	fs := newFlagSet("secret")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 2 || fs.Arg(0) != "set" {
+		fs.Usage()
+		return exitUsage
+	}
+
+	fmt.Fprintln(os.Stderr, "Enter the secret and press Enter:")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(os.Stderr, "no secret given")
+		return exitUsage
+	}
+	if err := config.Store(fs.Arg(1), strings.TrimRight(line, "\r\n")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Printf("Stored; use %s as the value of the setting\n", fs.Arg(1))
+	return exitOK
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gradechecker/pkg/config"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Outcomes of a doctor check.
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// globalKeys are the .env keys read by the bot and the dashboard.
+var globalKeys = append(slices.Clone(config.EnvKeys), "USAGE_PING_ENABLED", "REMOTE_VERSION_URL", "BOT_BINARY_PATH", "MAX_LOGS")
+
+// accountKeys are the .env keys that can be set per account with a suffix.
+var accountKeys = config.AccountEnvKeys
+
+// doctor collects the outcome of the diagnostic checks and prints each one
+// as soon as it is known, as the network checks can take a while.
+type doctor struct {
+	w      io.Writer
+	counts map[string]int
+}
+
+func (d *doctor) report(status, name, detail, remedy string) {
+	d.counts[status]++
+	fmt.Fprintf(d.w, "[%s] %s: %s\n", status, name, detail)
+	if remedy != "" {
+		fmt.Fprintf(d.w, "       Fix: %s\n", remedy)
+	}
+}
+
+func (d *doctor) pass(name, detail string)         { d.report(checkPass, name, detail, "") }
+func (d *doctor) warn(name, detail, remedy string) { d.report(checkWarn, name, detail, remedy) }
+func (d *doctor) fail(name, detail, remedy string) { d.report(checkFail, name, detail, remedy) }
+
+func cmdDoctor(args []string) int {
+	fs := newFlagSet("doctor")
+	offline := fs.Bool("offline", false, "skip the checks that contact CIS or Discord")
+	account := fs.String("account", "", "only check this account")
+	verbose := fs.Bool("v", false, "show the log output of the checks")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	accounts, err := selectAccounts(*account)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if !*verbose {
+		defer slog.SetDefault(slog.Default())
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+	}
+
+	return runDoctor(os.Stdout, accounts, *offline)
+}
+
+// runDoctor runs the checks for the accounts, prints the outcomes to w and
+// returns exitError if any check failed.
+func runDoctor(w io.Writer, accounts []Account, offline bool) int {
+	d := &doctor{w: w, counts: map[string]int{}}
+	d.checkEnv(loadAccounts())
+	d.checkDB()
+	for _, acc := range accounts {
+		d.checkAccount(acc)
+		if !offline && acc.Username != "" && acc.Password != "" {
+			d.checkConnectivity(acc)
+		}
+		d.checkParser(acc)
+		d.checkNotifiers(acc, offline)
+	}
+
+	fmt.Fprintf(d.w, "\n%d passed, %d warnings, %d failed\n", d.counts[checkPass], d.counts[checkWarn], d.counts[checkFail])
+	if d.counts[checkFail] > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// checkEnv validates the .env file: that it parses, has no unknown keys
+// (usually typos) and that the global settings have valid values.
+func (d *doctor) checkEnv(accounts []Account) {
+	env, err := godotenv.Read()
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		d.warn(".env", "no .env file found, only the process environment is used",
+			"Save the settings in the dashboard or create .env as described in the README")
+	case err != nil:
+		d.fail(".env", err.Error(), "Fix the syntax of .env; every line must look like KEY=value")
+	default:
+		known := make(map[string]bool)
+		for _, k := range globalKeys {
+			known[k] = true
+		}
+		for _, k := range accountKeys {
+			known[k] = true
+			for _, acc := range accounts {
+				known[k+"_"+config.EnvSuffix(acc.Name)] = true
+			}
+		}
+		var unknown []string
+		for k := range env {
+			if !known[k] {
+				unknown = append(unknown, k)
+			}
+		}
+		sort.Strings(unknown)
+		if len(unknown) > 0 {
+			d.warn(".env", "unknown keys "+strings.Join(unknown, ", "),
+				"Check the spelling; per-account keys need an account listed in ACCOUNTS")
+		} else {
+			d.pass(".env", fmt.Sprintf("%d keys", len(env)))
+		}
+	}
+
+	d.checkConfig()
+}
+
+// checkConfig validates the configuration file and environment and shows
+// the next planned check.
+func (d *doctor) checkConfig() {
+	cfg, err := loadConfig()
+	var errs config.Errors
+	switch {
+	case cfg == nil:
+		d.fail("config", err.Error(), "Fix the syntax of the file or set CONFIG_FILE to the right one")
+		return
+	case errors.As(err, &errs):
+		for _, e := range errs {
+			d.fail("config", e.Error(), "Correct the value; gradechecker config validate lists all problems")
+		}
+		return
+	case cfg.Path == "":
+		d.pass("config", "no config file, using the environment only")
+	default:
+		d.pass("config", "read "+cfg.Path)
+	}
+	for _, w := range cfg.Warnings() {
+		d.warn("config", w.Error(), "Fix the reference, or prefix the secret with plain: if it is meant as is")
+	}
+
+	if schedule, err := loadSchedule(cfg); err == nil {
+		d.pass("schedule", "next check at "+schedule.Next(time.Now()).Format("2006-01-02 15:04"))
+	}
+}
+
+// checkDB verifies that the database schema is current and writable
+// without migrating or changing it.
+func (d *doctor) checkDB() {
+	ctx := context.Background()
+	if _, err := os.Stat(dbFile); errors.Is(err, fs.ErrNotExist) && currentConfig().Database.URL == "" {
+		d.warn("database", dbFile+" does not exist yet", "It is created by the first check")
+		return
+	}
+	db, err := connectDB(ctx)
+	if err != nil {
+		d.fail("database", err.Error(), "Check database.url (DATABASE_URL)")
+		return
+	}
+	defer db.Close()
+
+	version, err := db.SchemaVersion(ctx)
+	if err != nil {
+		hint := "Restore " + dbFile + " from a backup or delete it to start over"
+		if db.Backend() == "postgres" {
+			hint = "Check database.url (DATABASE_URL) and that the server is reachable"
+		}
+		d.fail("database", fmt.Sprintf("%s cannot be read: %v", db.Name(), err), hint)
+		return
+	}
+	switch {
+	case version > schemaVersion:
+		d.fail("database", fmt.Sprintf("schema version %d is newer than this binary (%d)", version, schemaVersion),
+			"Update gradechecker")
+	case version < schemaVersion:
+		d.warn("database", fmt.Sprintf("schema version %d, current is %d", version, schemaVersion),
+			"Run gradechecker check --once to migrate it")
+	default:
+		d.pass("database", fmt.Sprintf("schema version %d is current", version))
+	}
+	if version == 0 {
+		return
+	}
+
+	// A write inside a rolled back transaction proves the database is
+	// writable and not locked by another process.
+	errRollback := errors.New("rollback")
+	err = db.Tx(ctx, func(tx Store) error {
+		if err := tx.SetStatus(ctx, "doctor", now()); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		hint := "Check the permissions of " + dbFile + " and its directory, and that no other process holds it locked"
+		if db.Backend() == "postgres" {
+			hint = "Check that the database user may write to the tables"
+		}
+		d.fail("database", fmt.Sprintf("%s is not writable: %v", db.Name(), err), hint)
+	} else {
+		d.pass("database", db.Name()+" is writable")
+	}
+
+	d.checkEncryption(ctx, db)
+
+	if _, failed, err := db.OutboxCounts(ctx); err == nil && failed > 0 {
+		d.warn("notifications", fmt.Sprintf("%d notifications could not be delivered", failed),
+			"Check the notification settings; the errors are in the last_error column of the outbox table")
+	}
+}
+
+// checkEncryption verifies the configured key against the database without
+// encrypting anything, and loads it for parsing the transcripts.
+func (d *doctor) checkEncryption(ctx context.Context, db Store) {
+	enc := currentConfig().Encryption
+	m, err := readEncryptionMarker(ctx, db)
+	switch {
+	case err != nil:
+		d.fail("encryption", err.Error(), "")
+	case m == nil && enc.Enabled():
+		d.warn("encryption", "configured, but the data is not encrypted yet", "It is encrypted by the next check")
+	case m != nil:
+		key, err := verifyEncryptionKey(ctx, enc, m)
+		if err != nil {
+			d.fail("encryption", err.Error(), "Configure the passphrase or key file the data was encrypted with")
+			return
+		}
+		atRest = key
+		d.pass("encryption", "the data is encrypted and the key matches")
+	}
+}
+
+// checkAccount validates the settings of an account.
+func (d *doctor) checkAccount(acc Account) {
+	name := acc.Label() + "account"
+	if acc.Username == "" || acc.Password == "" {
+		user, pass := "CIS_USERNAME", "CIS_PASSWORD"
+		if acc.Name != defaultAccount {
+			user += "_" + config.EnvSuffix(acc.Name)
+			pass += "_" + config.EnvSuffix(acc.Name)
+		}
+		d.fail(name, "credentials not configured", fmt.Sprintf("Set %s and %s", user, pass))
+	} else if config.IsSecretRef(acc.Password) {
+		if _, err := resolveSecret(context.Background(), acc.Password); err != nil {
+			d.fail(name, err.Error(), "Check the secret reference; gradechecker secret set stores a password in the keyring")
+		} else {
+			d.pass(name, "credentials configured for "+acc.Username+", password resolved")
+		}
+	} else {
+		d.pass(name, "credentials configured for "+acc.Username)
+	}
+
+	if _, err := sourcesFor(acc); err != nil {
+		d.fail(name, err.Error(), "Set GRADE_SOURCE to pdf, html or both")
+	}
+	for key, value := range map[string]string{"TRANSCRIPT_URL": acc.TranscriptURL, "RESULTS_URL": acc.ResultsURL} {
+		if u, err := url.Parse(value); err != nil || u.Scheme != "https" || u.Host == "" {
+			d.fail(name, fmt.Sprintf("%s %q is not an https URL", key, value),
+				"Copy the URL from the browser or remove "+key+" to use the default")
+		}
+	}
+	if mode := acc.Notify.DiscordMode; mode != "" && mode != "dm" && mode != "webhook" {
+		d.warn(name, fmt.Sprintf("unknown DISCORD_MODE %q, using webhook", mode), "Set DISCORD_MODE to dm or webhook")
+	}
+}
+
+// checkConnectivity logs in to CIS with a fresh session and checks that the
+// configured sources answer, reading only the start of each response.
+func (d *doctor) checkConnectivity(acc Account) {
+	name := acc.Label() + "CIS login"
+	client, err := sessions{}.client(acc.Name)
+	if err != nil {
+		d.fail(name, err.Error(), "")
+		return
+	}
+	start := time.Now()
+	if err := performLogin(context.Background(), client, acc.Username, acc.Password); err != nil {
+		if errors.Is(err, errNetwork) {
+			d.fail(name, err.Error(), "Check the internet connection and that cis.nordakademie.de is reachable")
+		} else {
+			d.fail(name, err.Error(), "Check the credentials by logging in to cis.nordakademie.de in the browser")
+		}
+		return
+	}
+	d.pass(name, fmt.Sprintf("logged in as %s in %s", acc.Username, time.Since(start).Round(time.Millisecond)))
+
+	if acc.Source != "html" {
+		name := acc.Label() + "transcript"
+		head, ct, err := peek(client, acc.TranscriptURL)
+		switch {
+		case err != nil:
+			d.fail(name, err.Error(), "Check TRANSCRIPT_URL")
+		case !bytes.HasPrefix(head, []byte("%PDF-")):
+			d.fail(name, fmt.Sprintf("TRANSCRIPT_URL returned %q instead of a PDF", ct),
+				"Copy the link of the \"Notenübersicht\" PDF from CIS into TRANSCRIPT_URL")
+		default:
+			d.pass(name, "TRANSCRIPT_URL returns a PDF")
+		}
+	}
+	if acc.Source == "html" || acc.Source == "both" {
+		name := acc.Label() + "results page"
+		head, _, err := peek(client, acc.ResultsURL)
+		switch {
+		case err != nil:
+			d.fail(name, err.Error(), "Check RESULTS_URL")
+		case bytes.Contains(head, []byte(`name="user"`)):
+			d.fail(name, "RESULTS_URL shows the login page", "Check RESULTS_URL")
+		default:
+			d.pass(name, "RESULTS_URL is reachable")
+		}
+	}
+}
+
+// peek returns the first bytes and the content type of a successful response.
+func peek(client *http.Client, target string) ([]byte, string, error) {
+	resp, err := client.Get(target)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("status: %d", resp.StatusCode)
+	}
+	head, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return head, resp.Header.Get("Content-Type"), err
+}
+
+// checkParser runs the parser on the last downloaded transcript.
+func (d *doctor) checkParser(acc Account) {
+	name := acc.Label() + "parser"
+	if acc.Source == "html" {
+		return
+	}
+	if _, err := os.Stat(acc.PDFFile); err != nil {
+		d.warn(name, "no transcript downloaded yet ("+acc.PDFFile+")", "Run gradechecker check --once")
+		return
+	}
+
+	start := time.Now()
+	grades, err := parsePdf(acc.PDFFile, "")
+	if err != nil {
+		d.fail(name, err.Error(), "Run gradechecker parse --raw "+acc.PDFFile+" and report the output")
+		return
+	}
+	modules := make(map[string]bool)
+	pending := 0
+	for _, g := range grades {
+		modules[g.Module] = true
+		if strings.TrimSpace(g.Grade) == "#" {
+			pending++
+		}
+	}
+	stats := fmt.Sprintf("%d grades in %d modules (%d pending) in %s", len(grades), len(modules), pending,
+		time.Since(start).Round(time.Millisecond))
+	if problems := checkSnapshot(0, grades); len(problems) > 0 {
+		d.warn(name, stats+"; "+strings.Join(problems, "; "),
+			"Run gradechecker parse --raw "+acc.PDFFile+" and report the output")
+		return
+	}
+	d.pass(name, stats)
+}
+
+// checkNotifiers dry-runs every enabled notification backend.
+func (d *doctor) checkNotifiers(acc Account, offline bool) {
+	enabled := notifiers(acc.Notify)
+	if len(enabled) == 0 {
+		d.warn(acc.Label()+"notifications", "no backend enabled",
+			"Enable Discord in the dashboard or install notify-send")
+		return
+	}
+	for _, n := range enabled {
+		name := acc.Label() + "notifications " + n.Name()
+		dr, ok := n.(dryRunner)
+		if !ok || (offline && n.Name() != "desktop") {
+			d.pass(name, "enabled, not tested")
+			continue
+		}
+		if err := dr.DryRun(context.Background()); err != nil {
+			d.fail(name, err.Error(), "Check the Discord settings in the dashboard, then run gradechecker test-notify --backend "+n.Name())
+			continue
+		}
+		d.pass(name, "configuration works")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"gradechecker/pkg/config"
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	credentials := map[string]string{"CIS_USERNAME": "alice", "CIS_PASSWORD": "hunter2"}
+	for _, tc := range []struct {
+		name    string
+		env     map[string]string
+		offline bool
+		code    int
+		want    []string
+	}{
+		{
+			name: "missing config file",
+			env:  map[string]string{"CONFIG_FILE": "missing.yaml"},
+			code: exitError,
+			want: []string{"[FAIL] config: ", "[WARN] .env: no .env file found"},
+		},
+		{
+			name:    "warnings only",
+			env:     credentials,
+			offline: true,
+			code:    exitOK,
+			want: []string{"[WARN] .env: ", "[PASS] config: ", "[WARN] database: grades.db does not exist yet",
+				"[PASS] account: credentials configured for alice", "[WARN] parser: no transcript downloaded yet"},
+		},
+		{
+			name:    "malformed secret reference",
+			env:     map[string]string{"CIS_USERNAME": "alice", "CIS_PASSWORD": "env:my password"},
+			offline: true,
+			code:    exitOK,
+			want:    []string{"[WARN] config: env CIS_PASSWORD: accounts[0].password: starts with env: but is no valid reference"},
+		},
+		{
+			name:    "unreachable database",
+			env:     map[string]string{"DATABASE_URL": "postgres://gradechecker@127.0.0.1:1/gradechecker?connect_timeout=2"},
+			offline: true,
+			code:    exitError,
+			want:    []string{"[FAIL] database: ", "[FAIL] account: credentials not configured"},
+		},
+		{
+			// Without credentials, so CIS is not contacted
+			name: "bad notifier config",
+			env:  map[string]string{"DISCORD_ENABLED": "true", "DISCORD_MODE": "webhook"},
+			code: exitError,
+			want: []string{"[FAIL] notifications discord-webhook: Webhook mode enabled but missing URL"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Cleanup(func() { current.Store(nil) })
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			cfg, _ := loadConfig()
+			if cfg == nil {
+				cfg = config.Default()
+			}
+			current.Store(cfg)
+			accounts, err := selectAccounts("")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out strings.Builder
+			if code := runDoctor(&out, accounts, tc.offline); code != tc.code {
+				t.Errorf("exit code %d, want %d", code, tc.code)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("missing %q in\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gradechecker/pkg/config"
+	"gradechecker/pkg/crypt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// atRest is the key of the at-rest encryption, nil if it is disabled. It is
+// set by openDB before any grade is read or written.
+var atRest *crypt.Key
+
+// encryptionStatusKey is the system_status key of the encryptionMarker.
+const encryptionStatusKey = "encryption"
+
+// encryptionCheck is sealed into the marker to recognise a wrong key.
+const encryptionCheck = "gradechecker"
+
+// encryptionMarker records in the database how its data is encrypted.
+type encryptionMarker struct {
+	// KDF is "scrypt" for a passphrase or "keyfile".
+	KDF   string `json:"kdf"`
+	Salt  []byte `json:"salt,omitempty"`
+	Check string `json:"check"`
+}
+
+// sealedColumns hold grades, or notification messages quoting them. Module
+// names stay readable as they identify the rows.
+var sealedColumns = []struct{ table, column string }{
+	{"grades_v2", "grade"},
+	{"grade_events", "grade"},
+	{"grade_events", "previous_grade"},
+	{"outbox", "message"},
+}
+
+// sealValue encrypts a value for the database if encryption is enabled.
+// Empty values stay empty.
+func sealValue(s string) string {
+	if atRest == nil || s == "" {
+		return s
+	}
+	return atRest.SealValue(s)
+}
+
+// openValue decrypts a value read from the database.
+func openValue(s string) (string, error) {
+	if !crypt.IsSealedValue(s) {
+		return s, nil
+	}
+	if atRest == nil {
+		return "", errors.New("value is encrypted, but no encryption key is configured")
+	}
+	return atRest.OpenValue(s)
+}
+
+// writePrivateFile writes a file only the owner can read, encrypted if
+// encryption is enabled. It is replaced atomically, so a crash never leaves
+// half a file behind.
+func writePrivateFile(path string, data []byte) error {
+	if atRest != nil {
+		data = atRest.SealFile(data)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(tmp, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readPrivateFile reads a file written by writePrivateFile (or any plain
+// file).
+func readPrivateFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !crypt.IsSealedFile(data) {
+		return data, err
+	}
+	if atRest == nil {
+		return nil, fmt.Errorf("%s is encrypted, but no encryption key is configured", path)
+	}
+	data, err = atRest.OpenFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+// setupEncryption loads the key configured in encryption (see config.Encryption)
+// and checks it against the database. A database that is not encrypted
+// yet is encrypted, along with the transcripts, when a key is configured.
+func setupEncryption(ctx context.Context, db Store) error {
+	enc := currentConfig().Encryption
+	m, err := readEncryptionMarker(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case m == nil && !enc.Enabled():
+		atRest = nil
+		return nil
+	case m == nil:
+		key, m, err := newEncryptionKey(ctx, enc)
+		if err != nil {
+			return err
+		}
+		n, err := rekey(ctx, db, nil, key, m)
+		if err != nil {
+			return fmt.Errorf("encrypting the data: %w", err)
+		}
+		slog.Info("Encrypted the database and transcripts", "values", n.values, "files", n.files)
+		return nil
+	}
+
+	key, err := verifyEncryptionKey(ctx, enc, m)
+	if err != nil {
+		return err
+	}
+	atRest = key
+	return nil
+}
+
+// verifyEncryptionKey returns the configured key if it is the one the data
+// is encrypted with.
+func verifyEncryptionKey(ctx context.Context, enc config.Encryption, m *encryptionMarker) (*crypt.Key, error) {
+	if !enc.Enabled() {
+		return nil, errors.New("the database is encrypted; configure encryption.passphrase or encryption.key_file (ENCRYPTION_PASSPHRASE, ENCRYPTION_KEY_FILE)")
+	}
+	key, err := encryptionKey(ctx, enc, m)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := key.OpenValue(m.Check); err != nil || check != encryptionCheck {
+		if m.KDF == "scrypt" {
+			return nil, errors.New("wrong encryption passphrase")
+		}
+		return nil, errors.New("wrong encryption key file")
+	}
+	return key, nil
+}
+
+func readEncryptionMarker(ctx context.Context, db Store) (*encryptionMarker, error) {
+	value, err := db.Status(ctx, encryptionStatusKey)
+	if value == "" || err != nil {
+		return nil, err
+	}
+	var m encryptionMarker
+	if err := json.Unmarshal([]byte(value), &m); err != nil {
+		return nil, fmt.Errorf("invalid encryption status: %w", err)
+	}
+	return &m, nil
+}
+
+// encryptionKey derives the configured key with the parameters of the
+// marker.
+func encryptionKey(ctx context.Context, enc config.Encryption, m *encryptionMarker) (*crypt.Key, error) {
+	switch {
+	case m.KDF == "scrypt" && enc.Passphrase != "":
+		passphrase, err := resolveSecret(ctx, enc.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return crypt.FromPassphrase(passphrase, m.Salt)
+	case m.KDF == "keyfile" && enc.KeyFile != "":
+		data, err := os.ReadFile(enc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key file: %w", err)
+		}
+		return crypt.FromKeyFile(data)
+	case m.KDF == "scrypt":
+		return nil, errors.New("the data is encrypted with a passphrase, but a key file is configured; switch with gradechecker rekey")
+	default:
+		return nil, errors.New("the data is encrypted with a key file, but a passphrase is configured; switch with gradechecker rekey")
+	}
+}
+
+// newEncryptionKey derives a key for data that is not encrypted with it
+// yet, using a fresh salt.
+func newEncryptionKey(ctx context.Context, enc config.Encryption) (*crypt.Key, *encryptionMarker, error) {
+	m := &encryptionMarker{KDF: "keyfile"}
+	if enc.Passphrase != "" {
+		m = &encryptionMarker{KDF: "scrypt", Salt: crypt.NewSalt()}
+	}
+	key, err := encryptionKey(ctx, enc, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.Check = key.SealValue(encryptionCheck)
+	return key, m, nil
+}
+
+type rekeyCount struct {
+	values, files int
+}
+
+// rekey re-encrypts the sealed columns, transcripts and quarantined
+// snapshots from the old key to the new one. Either may be nil for
+// unencrypted data; a nil marker removes the encryption.
+//
+// The database is converted in one transaction and then compacted, so the
+// old values are not left in its free space. The files follow after the
+// commit; if that is interrupted, the transcripts are simply downloaded
+// again by the next check.
+func rekey(ctx context.Context, db Store, old, new *crypt.Key, m *encryptionMarker) (rekeyCount, error) {
+	var n rekeyCount
+	open := func(s string) (string, error) {
+		if old == nil {
+			if crypt.IsSealedValue(s) {
+				return "", errors.New("found an encrypted value in an unencrypted database")
+			}
+			return s, nil
+		}
+		return old.OpenValue(s)
+	}
+
+	err := db.Tx(ctx, func(tx Store) error {
+		var err error
+		n.values, err = tx.Reseal(ctx, func(value string) (string, error) {
+			plain, err := open(value)
+			if err != nil || new == nil {
+				return plain, err
+			}
+			return new.SealValue(plain), nil
+		})
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			_, err = tx.DeleteStatus(ctx, encryptionStatusKey)
+			return err
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return tx.SetStatus(ctx, encryptionStatusKey, string(data))
+	})
+	if err != nil {
+		return n, err
+	}
+	if err := db.Compact(ctx); err != nil {
+		slog.Warn("Error compacting the database, the previous values may remain in its free space", "err", err)
+	}
+
+	atRest = new
+	for _, path := range privateFiles() {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return n, err
+		}
+		if old != nil {
+			if data, err = old.OpenFile(data); err != nil {
+				return n, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		if err := writePrivateFile(path, data); err != nil {
+			return n, err
+		}
+		n.files++
+	}
+	return n, nil
+}
+
+// privateFiles lists the files with grades besides the database: the
+// transcripts and the quarantined snapshots.
+func privateFiles() []string {
+	var paths []string
+	for _, acc := range loadAccounts() {
+		paths = append(paths, acc.PDFFile)
+	}
+	entries, _ := os.ReadDir(quarantineDir)
+	for _, e := range entries {
+		if !e.IsDir() && !strings.HasSuffix(e.Name(), ".tmp") {
+			paths = append(paths, filepath.Join(quarantineDir, e.Name()))
+		}
+	}
+	return paths
+}
+
+func cmdRekey(args []string) int {
+	flags := newFlagSet("rekey")
+	passphrase := flags.String("passphrase", "", "encrypt with this passphrase, a secret reference like keyring:gradechecker/db,\nor - to read it from stdin")
+	keyFile := flags.String("key-file", "", "encrypt with this key file, which is created if it does not exist")
+	decrypt := flags.Bool("decrypt", false, "remove the encryption")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+	chosen := 0
+	for _, set := range []bool{*passphrase != "", *keyFile != "", *decrypt} {
+		if set {
+			chosen++
+		}
+	}
+	if chosen != 1 || flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer db.Close()
+	inst, err := acquireInstance(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer inst.Release()
+
+	var enc config.Encryption
+	switch {
+	case *passphrase == "-":
+		fmt.Fprintln(os.Stderr, "Enter the new passphrase and press Enter:")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			fmt.Fprintln(os.Stderr, "no passphrase given")
+			return exitUsage
+		}
+		enc.Passphrase = "plain:" + line
+	case *passphrase != "":
+		enc.Passphrase = *passphrase
+	case *keyFile != "":
+		enc.KeyFile = *keyFile
+		if _, err := os.Stat(*keyFile); errors.Is(err, fs.ErrNotExist) {
+			if err := os.WriteFile(*keyFile, crypt.NewKeyFile(), 0600); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitError
+			}
+			fmt.Printf("Created the key file %s; keep a copy, without it the data cannot be read\n", *keyFile)
+		}
+	}
+
+	var key *crypt.Key
+	var m *encryptionMarker
+	if !*decrypt {
+		if key, m, err = newEncryptionKey(ctx, enc); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	n, err := rekey(ctx, db, atRest, key, m)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	fmt.Printf("Re-encrypted %d values and %d files.\n", n.values, n.files)
+	switch {
+	case *decrypt:
+		fmt.Println("Remove encryption.passphrase and encryption.key_file (ENCRYPTION_PASSPHRASE, ENCRYPTION_KEY_FILE) from the configuration.")
+	case *keyFile != "":
+		fmt.Printf("Set encryption.key_file (ENCRYPTION_KEY_FILE) to %s and remove the passphrase from the configuration.\n", *keyFile)
+	case config.IsSecretRef(*passphrase) && !strings.HasPrefix(*passphrase, "plain:"):
+		fmt.Printf("Set encryption.passphrase (ENCRYPTION_PASSPHRASE) to %s and remove the key file from the configuration.\n", *passphrase)
+	default:
+		// A plain passphrase is never printed
+		fmt.Println("Set encryption.passphrase (ENCRYPTION_PASSPHRASE) to the new passphrase and remove the key file from the configuration.")
+	}
+	return exitOK
+}
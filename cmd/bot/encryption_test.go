@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gradechecker/pkg/config"
+	"gradechecker/pkg/crypt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncryptionAtRest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() {
+		current.Store(nil)
+		atRest = nil
+	})
+	useConfig := func(env map[string]string) {
+		cfg, err := config.Load("", func(key string) string { return env[key] })
+		if err != nil {
+			t.Fatal(err)
+		}
+		current.Store(cfg)
+	}
+	rawGrade := func() string {
+		db, err := openDB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		var grade string
+		if err := db.(*sqlStore).queryRow(context.Background(), "SELECT grade FROM grades_v2").Scan(&grade); err != nil {
+			t.Fatal(err)
+		}
+		return grade
+	}
+
+	// An unencrypted database with a grade and a transcript
+	useConfig(nil)
+	db, err := openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.InsertGrade(context.Background(), storedGrade{Account: "default", Module: "Mathematik", Grade: "1,3",
+		Status: eventNew, UpdatedAt: "2025-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Delivered notifications that were purged
+	for i := range 50 {
+		if err := db.Enqueue(context.Background(), "default", "fake", fmt.Sprintf("New Grade: Mathematik - 1,3 (%d)", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.(*sqlStore).exec(context.Background(), "DELETE FROM outbox"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := os.WriteFile("grades.pdf", []byte("%PDF-1.4 transcript"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Configuring a passphrase encrypts the existing data
+	useConfig(map[string]string{"ENCRYPTION_PASSPHRASE": "correct horse"})
+	if got := rawGrade(); !crypt.IsSealedValue(got) {
+		t.Errorf("grade stored as %q, want it encrypted", got)
+	}
+	db, err = openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	grades, err := db.Grades(context.Background(), "", "")
+	db.Close()
+	if err != nil || len(grades) != 1 || grades[0].Grade != "1,3" {
+		t.Errorf("Grades = %+v, %v", grades, err)
+	}
+	// No plaintext is left in free pages or the journal
+	for _, name := range []string{"grades.db", "grades.db-wal"} {
+		if data, _ := os.ReadFile(name); bytes.Contains(data, []byte("New Grade: Mathematik")) {
+			t.Errorf("%s still contains the plaintext message", name)
+		}
+	}
+	if data, _ := os.ReadFile("grades.pdf"); !crypt.IsSealedFile(data) {
+		t.Error("transcript not encrypted")
+	}
+	if data, err := readPrivateFile("grades.pdf"); err != nil || !bytes.Equal(data, []byte("%PDF-1.4 transcript")) {
+		t.Errorf("readPrivateFile = %q, %v", data, err)
+	}
+	for _, name := range []string{"grades.db", "grades.pdf"} {
+		if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode %v, %v", name, info.Mode().Perm(), err)
+		}
+	}
+
+	// A wrong or missing key is refused
+	useConfig(map[string]string{"ENCRYPTION_PASSPHRASE": "wrong"})
+	if _, err := openDB(); err == nil || !strings.Contains(err.Error(), "wrong encryption passphrase") {
+		t.Errorf("wrong passphrase: %v", err)
+	}
+	useConfig(nil)
+	if _, err := openDB(); err == nil || !strings.Contains(err.Error(), "is encrypted") {
+		t.Errorf("no passphrase: %v", err)
+	}
+
+	// Rekeying to a key file, then decrypting
+	useConfig(map[string]string{"ENCRYPTION_PASSPHRASE": "correct horse"})
+	db, err = openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("gradechecker.key", crypt.NewKeyFile(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, m, err := newEncryptionKey(context.Background(), config.Encryption{KeyFile: "gradechecker.key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := rekey(context.Background(), db, atRest, key, m); err != nil || n.values != 1 || n.files != 1 {
+		t.Errorf("rekey = %+v, %v", n, err)
+	}
+	db.Close()
+
+	useConfig(map[string]string{"ENCRYPTION_KEY_FILE": "gradechecker.key"})
+	db, err = openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rekey(context.Background(), db, atRest, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	useConfig(nil)
+	if got := rawGrade(); got != "1,3" {
+		t.Errorf("decrypted grade = %q", got)
+	}
+	if data, _ := os.ReadFile("grades.pdf"); crypt.IsSealedFile(data) {
+		t.Error("transcript still encrypted")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Types of the events on the bus.
+const (
+	busLog                = "log"
+	busCheckStarted       = "check_started"
+	busCheckFinished      = "check_finished"
+	busSessionRenewed     = "session_renewed"
+	busGrade              = "grade"
+	busNotificationSent   = "notification_sent"
+	busNotificationFailed = "notification_failed"
+)
+
+const (
+	// busHistory is how many events are kept for clients that resume.
+	busHistory = 1000
+	// sseHeartbeat keeps idle streams from being closed by proxies.
+	sseHeartbeat = 30 * time.Second
+)
+
+// busEvent is a log record or domain event with its stream ID.
+type busEvent struct {
+	ID   int64
+	Type string
+	Data json.RawMessage
+}
+
+// eventBus fans out log records and domain events to the SSE clients and
+// keeps the latest ones so a client can resume after a reconnect.
+type eventBus struct {
+	mu     sync.Mutex
+	nextID int64
+	buf    []busEvent
+	subs   map[chan busEvent]struct{}
+}
+
+// bus is the process-wide event bus.
+var bus = newEventBus()
+
+// newEventBus starts the IDs at the current time in milliseconds, so they
+// keep increasing across restarts and a client resuming with an ID from an
+// earlier run does not skip events.
+func newEventBus() *eventBus {
+	return &eventBus{
+		nextID: time.Now().UnixMilli(),
+		subs:   make(map[chan busEvent]struct{}),
+	}
+}
+
+// Publish sends an event to all subscribers. data is encoded as JSON.
+func (b *eventBus) Publish(typ string, data any) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		// Never log here, log output is published itself.
+		raw, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	e := busEvent{ID: b.nextID, Type: typ, Data: raw}
+	b.buf = append(b.buf, e)
+	if len(b.buf) > busHistory {
+		b.buf = b.buf[len(b.buf)-busHistory:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// Too slow: drop the client, it resumes with Last-Event-ID.
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the kept events after the given ID and a channel for
+// new ones. The channel is closed when the client falls too far behind.
+func (b *eventBus) Subscribe(after int64) ([]busEvent, chan busEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []busEvent
+	for _, e := range b.buf {
+		if e.ID > after {
+			replay = append(replay, e)
+		}
+	}
+	ch := make(chan busEvent, 256)
+	b.subs[ch] = struct{}{}
+	return replay, ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Write publishes a log record written by a slog.JSONHandler, which writes
+// one record per call.
+func (b *eventBus) Write(p []byte) (int, error) {
+	b.Publish(busLog, json.RawMessage(bytes.TrimSpace(p)))
+	return len(p), nil
+}
+
+// events streams the bus as Server-Sent Events. Clients resume with the
+// Last-Event-ID header (sent by EventSource on reconnect) or ?last_event_id=,
+// and can select event types with ?types=log,grade.
+func (a *api) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	after, _ := strconv.ParseInt(lastID, 10, 64)
+	var types map[string]bool
+	if t := r.URL.Query().Get("types"); t != "" {
+		types = make(map[string]bool)
+		for _, typ := range splitList(t) {
+			types[typ] = true
+		}
+	}
+
+	replay, ch, cancel := a.bus.Subscribe(after)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(e busEvent) bool {
+		if types != nil && !types[e.Type] {
+			return true
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+		return err == nil
+	}
+	for _, e := range replay {
+		if !send(e) {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok || !send(e) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEventStreamResumes(t *testing.T) {
+	bus.Publish(busCheckStarted, map[string]string{"account": "default"})
+	replay, _, cancel := bus.Subscribe(0)
+	cancel()
+	first := replay[len(replay)-1].ID
+
+	bus.Publish(busLog, map[string]string{"msg": "hello"})
+	bus.Publish(busGrade, GradeEvent{Type: eventNew, Module: "Mathematik I", Grade: "1,7"})
+
+	srv := httptest.NewServer(newAPI(nil, "secret", ""))
+	defer srv.Close()
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/events?token=secret&types=grade,log", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(first, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	var got []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(got) < 2 && scanner.Scan() {
+		if typ, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			got = append(got, typ)
+		}
+	}
+	if strings.Join(got, ",") != "log,grade" {
+		t.Errorf("resumed stream sent %v, want [log grade]", got)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportedGrade is a stored grade with its history, as written by export.
+type exportedGrade struct {
+	storedGrade
+	History []GradeEvent `json:"history"`
+}
+
+// queryExport returns the stored grades of an account (or all accounts)
+// with their history, oldest event first.
+func queryExport(ctx context.Context, db Store, account string) ([]exportedGrade, error) {
+	grades, err := db.Grades(ctx, account, "")
+	if err != nil {
+		return nil, err
+	}
+	events, err := db.AccountEvents(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		account, module string
+		occurrence      int
+	}
+	history := make(map[key][]GradeEvent)
+	for _, e := range events {
+		k := key{e.Account, e.Module, e.OccurrenceIndex}
+		history[k] = append(history[k], e)
+	}
+	exported := make([]exportedGrade, len(grades))
+	for i, g := range grades {
+		h := history[key{g.Account, g.Module, g.OccurrenceIndex}]
+		if h == nil {
+			h = []GradeEvent{}
+		}
+		exported[i] = exportedGrade{g, h}
+	}
+	return exported, nil
+}
+
+func writeExportJSON(w io.Writer, grades []exportedGrade) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Grades []exportedGrade `json:"grades"`
+	}{grades})
+}
+
+// writeExportCSV writes one row per grade. The history is folded into one
+// column, e.g. "2026-07-02 new #; 2026-07-20 changed 1,7", so the file
+// stays a single table for spreadsheets.
+func writeExportCSV(w io.Writer, grades []exportedGrade) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"account", "module", "attempt", "grade", "status", "updated_at", "history"})
+	for _, g := range grades {
+		var history []string
+		for _, e := range g.History {
+			history = append(history, strings.TrimSpace(fmt.Sprintf("%s %s %s", eventDate(e.Time), e.Type, e.Grade)))
+		}
+		cw.Write([]string{g.Account, g.Module, strconv.Itoa(g.OccurrenceIndex + 1), g.Grade, g.Status, g.UpdatedAt,
+			strings.Join(history, "; ")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeExportICS writes an all-day event for every grade that appeared,
+// on the day the bot found it. Placeholder grades ("#"), removals and the
+// grades of an account's initial sync, whose date is only when the bot
+// first ran, are left out.
+//
+// The UID of an event is derived from the grade, with the module name it
+// was recorded under, and the time it appeared, so importing a later
+// export updates the calendar instead of duplicating the events, even
+// after the module was renamed or merged.
+func writeExportICS(w io.Writer, grades []exportedGrade) error {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		b.WriteString(foldICSLine(fmt.Sprintf(format, args...)))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//gradechecker//export//EN")
+	line("CALSCALE:GREGORIAN")
+	for _, g := range grades {
+		label := Account{Name: g.Account}.Label()
+		for _, e := range g.History {
+			if e.Type == eventRemoved || e.Silent || strings.TrimSpace(e.Grade) == "#" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, e.Time)
+			if err != nil {
+				return fmt.Errorf("event of %s: %w", e.Module, err)
+			}
+			uid := sha256.Sum256([]byte(strings.Join([]string{e.Account, cmp.Or(e.RecordedModule, e.Module), strconv.Itoa(e.OccurrenceIndex), e.Time}, "\x00")))
+			description := "Grade " + e.Grade
+			if e.PreviousGrade != "" && e.PreviousGrade != "#" {
+				description = fmt.Sprintf("Grade changed from %s to %s", e.PreviousGrade, e.Grade)
+			}
+
+			line("BEGIN:VEVENT")
+			line("UID:%s@gradechecker", hex.EncodeToString(uid[:16]))
+			line("DTSTAMP:%s", t.UTC().Format("20060102T150405Z"))
+			line("DTSTART;VALUE=DATE:%s", t.Format("20060102"))
+			line("SUMMARY:%s", escapeICS(fmt.Sprintf("%s%s: %s", label, e.Module, e.Grade)))
+			line("DESCRIPTION:%s", escapeICS(description))
+			line("TRANSP:TRANSPARENT")
+			line("END:VEVENT")
+		}
+	}
+	line("END:VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escapeICS escapes a TEXT value (RFC 5545, section 3.3.11).
+func escapeICS(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// foldICSLine terminates a content line with CRLF, folding it after 75
+// octets without splitting a UTF-8 character (RFC 5545, section 3.1).
+func foldICSLine(s string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// eventDate returns the date part of an event time.
+func eventDate(t string) string {
+	date, _, _ := strings.Cut(t, "T")
+	return date
+}
+
+func cmdExport(args []string) int {
+	fs := newFlagSet("export")
+	format := fs.String("format", "csv", "output format: csv, json or ics")
+	account := fs.String("account", "", "only export grades of this account")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	write := map[string]func(io.Writer, []exportedGrade) error{
+		"csv":  writeExportCSV,
+		"json": writeExportJSON,
+		"ics":  writeExportICS,
+	}[*format]
+	if write == nil || fs.NArg() > 0 {
+		if write == nil {
+			fmt.Fprintf(os.Stderr, "invalid --format %q\n", *format)
+		}
+		fs.Usage()
+		return exitUsage
+	}
+
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer db.Close()
+
+	grades, err := queryExport(context.Background(), db, *account)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		// The export holds the grades in plaintext, so it is private like the database
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w, grades); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		if err := f.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		for _, g := range []storedGrade{
+			{Account: "default", Module: "Mathematik I", Grade: "1,7", Status: eventNew, UpdatedAt: "2026-07-20T10:00:00+02:00"},
+			{Account: "default", Module: "Recht; Ethik, Gesellschaft und ein sehr langer Modulname", Grade: "2,0", Status: eventNew, UpdatedAt: "2026-07-21T10:00:00+02:00"},
+		} {
+			if err := db.InsertGrade(ctx, g); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, e := range []GradeEvent{
+			{Account: "default", Type: eventNew, Module: "Mathematik I", Grade: "#", Time: "2026-07-02T10:00:00+02:00"},
+			{Account: "default", Type: eventChanged, Module: "Mathematik I", Grade: "1,7", PreviousGrade: "#", Time: "2026-07-20T10:00:00+02:00"},
+			{Account: "default", Type: eventNew, Module: "Recht; Ethik, Gesellschaft und ein sehr langer Modulname", Grade: "2,0", Time: "2026-07-21T10:00:00+02:00"},
+		} {
+			if err := db.AddEvent(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		grades, err := queryExport(ctx, db, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(grades) != 2 || len(grades[0].History) != 2 || len(grades[1].History) != 1 {
+			t.Fatalf("grades = %+v", grades)
+		}
+
+		var buf bytes.Buffer
+		if err := writeExportCSV(&buf, grades); err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 3 || records[1][1] != "Mathematik I" || records[1][6] != "2026-07-02 new #; 2026-07-20 changed 1,7" {
+			t.Errorf("csv = %q", records)
+		}
+
+		export := func() string {
+			var buf bytes.Buffer
+			if err := writeExportICS(&buf, grades); err != nil {
+				t.Fatal(err)
+			}
+			return buf.String()
+		}
+		ics := export()
+		if ics != export() {
+			t.Error("ICS export is not stable")
+		}
+		if n := strings.Count(ics, "BEGIN:VEVENT"); n != 2 {
+			t.Errorf("%d events, want 2 (the placeholder is left out)", n)
+		}
+		for _, want := range []string{
+			"DTSTART;VALUE=DATE:20260720\r\n",
+			"DESCRIPTION:Grade 1\\,7\r\n",
+			"SUMMARY:Recht\\; Ethik\\, Gesellschaft",
+		} {
+			if !strings.Contains(ics, want) {
+				t.Errorf("missing %q in\n%s", want, ics)
+			}
+		}
+		for _, line := range strings.Split(ics, "\r\n") {
+			if len(line) > 75 {
+				t.Errorf("line longer than 75 octets: %q", line)
+			}
+		}
+	})
+}
+
+func TestExportICSUIDsSurviveModuleChanges(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		for _, g := range []storedGrade{
+			{Account: "default", Module: "Programmieren", Grade: "2,0", Status: eventNew},
+			{Account: "default", Module: "Mathematik I", Grade: "1,7", Status: eventNew},
+			{Account: "bob", Module: "Mathe\u200bmatik I", Grade: "3,0", Status: eventNew},
+		} {
+			if err := db.InsertGrade(ctx, g); err != nil {
+				t.Fatal(err)
+			}
+			e := GradeEvent{Account: g.Account, Type: eventNew, Module: g.Module, Grade: g.Grade, Time: "2026-07-02T10:00:00Z"}
+			if err := db.AddEvent(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		uids := func() []string {
+			grades, err := queryExport(ctx, db, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := writeExportICS(&buf, grades); err != nil {
+				t.Fatal(err)
+			}
+			var uids []string
+			for _, line := range strings.Split(buf.String(), "\r\n") {
+				if strings.HasPrefix(line, "UID:") {
+					uids = append(uids, line)
+				}
+			}
+			slices.Sort(uids)
+			return uids
+		}
+		before := uids()
+		if len(before) != 3 {
+			t.Fatalf("UIDs = %q", before)
+		}
+
+		catalog, err := db.Modules(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make(map[string]int64)
+		for _, m := range catalog {
+			ids[m.Name] = m.ID
+		}
+		m, err := db.Module(ctx, ids["Programmieren"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Name = "Programmierung"
+		if err := db.UpdateModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.MergeModules(ctx, ids["Mathematik I"], ids["Mathe\u200bmatik I"]); err != nil {
+			t.Fatal(err)
+		}
+		if after := uids(); !slices.Equal(after, before) {
+			t.Errorf("UIDs after renaming and merging = %q, want %q", after, before)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestTranscriptGolden parses every anonymised transcript in
+// testdata/transcripts and compares the result with its .golden.json file.
+// Run with -update after an intended parser change.
+func TestTranscriptGolden(t *testing.T) {
+	files, err := filepath.Glob("testdata/transcripts/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		if strings.HasSuffix(file, ".golden.json") {
+			continue
+		}
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			grades, err := parseFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGradeInvariants(t, grades)
+
+			got, err := json.MarshalIndent(grades, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := file + ".golden.json"
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("parser output differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// checkGradeInvariants verifies properties every parser result must have.
+func checkGradeInvariants(t *testing.T, grades []Grade) {
+	t.Helper()
+	seen := make(map[string]int)
+	for i, g := range grades {
+		if strings.TrimSpace(g.Module) == "" {
+			t.Errorf("grade %d has an empty module name: %+v", i, g)
+		}
+		if g.OccurrenceIndex != seen[g.Module] {
+			t.Errorf("grade %d (%q) has occurrence index %d, want %d", i, g.Module, g.OccurrenceIndex, seen[g.Module])
+		}
+		seen[g.Module]++
+	}
+}
+
+func addSeeds(f *testing.F, pattern string) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+}
+
+func FuzzExtractGrades(f *testing.F) {
+	addSeeds(f, "testdata/transcripts/*.txt")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkGradeInvariants(t, extractGrades(string(data)))
+	})
+}
+
+func FuzzExtractGradesHTML(f *testing.F) {
+	f.Add([]byte(resultsPage))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		grades, err := extractGradesHTML(bytes.NewReader(data))
+		if err == nil {
+			checkGradeInvariants(t, grades)
+		}
+	})
+}
+
+func FuzzParsePdf(f *testing.F) {
+	pdfTimeout = time.Second
+	addSeeds(f, "testdata/transcripts/*.pdf")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(t.TempDir(), "fuzz.pdf")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		grades, err := parsePdf(path, "")
+		if err == nil {
+			checkGradeInvariants(t, grades)
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerThreshold is the number of failed checks in a row after which
+	// the checks of an account are paused for breakerCooldown, so a wrong
+	// password does not get the CIS account locked and an outage is not
+	// hammered. After the pause one check is tried; if it fails too, the
+	// checks are paused again.
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Minute
+
+	// staleGrace is added to the staleness deadline to allow for slow checks.
+	staleGrace = 5 * time.Minute
+)
+
+// errCircuitOpen is returned for the checks skipped while an account is paused.
+var errCircuitOpen = errors.New("checks paused")
+
+// breaker counts the failed checks of an account in a row.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	lastErr   error
+}
+
+// healthState is what the daemon knows about its own health: the schedule
+// and accounts it checks and the circuit breakers of the accounts.
+type healthState struct {
+	mu       sync.Mutex
+	started  time.Time
+	schedule *plan
+	accounts []string
+	breakers map[string]*breaker
+}
+
+// health is the health state of the process.
+var health = newHealthState()
+
+func newHealthState() *healthState {
+	return &healthState{started: time.Now(), breakers: make(map[string]*breaker)}
+}
+
+// watch sets the schedule and the accounts checked by the daemon. Until it
+// is called nothing is considered stale.
+func (h *healthState) watch(schedule *plan, accounts []Account) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.schedule = schedule
+	h.accounts = nil
+	for _, acc := range accounts {
+		h.accounts = append(h.accounts, acc.Name)
+	}
+}
+
+// allow returns errCircuitOpen, wrapping the last failure, if the checks of
+// the account are paused.
+func (h *healthState) allow(account string, now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b := h.breakers[account]
+	if b == nil || !now.Before(b.openUntil) {
+		return nil
+	}
+	return fmt.Errorf("%w until %s after %d failed checks in a row: %w",
+		errCircuitOpen, b.openUntil.Format("15:04:05"), b.failures, b.lastErr)
+}
+
+// record updates the breaker of an account with the result of a check.
+func (h *healthState) record(account string, err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		delete(h.breakers, account)
+		return
+	}
+	b := h.breakers[account]
+	if b == nil {
+		b = &breaker{}
+		h.breakers[account] = b
+	}
+	b.failures++
+	b.lastErr = err
+	if b.failures >= breakerThreshold {
+		b.openUntil = now.Add(breakerCooldown)
+		slog.Warn("Too many failed checks in a row, pausing the checks of the account",
+			"account", account, "failures", b.failures, "until", b.openUntil.Format("15:04:05"))
+	}
+}
+
+// openBreakers returns the accounts whose checks are paused.
+func (h *healthState) openBreakers(now time.Time) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var open []string
+	for account, b := range h.breakers {
+		if now.Before(b.openUntil) {
+			open = append(open, account)
+		}
+	}
+	slices.Sort(open)
+	return open
+}
+
+// staleAccount is an account without a successful check in time.
+type staleAccount struct {
+	Account string `json:"account"`
+	// LastCheck is the last successful check, empty if there was none.
+	LastCheck string `json:"last_check,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// stale returns the accounts whose last successful check is more than two
+// planned runs ago. Checks before the process started are not held against
+// it: after a restart, the deadline counts from the start.
+func (h *healthState) stale(ctx context.Context, db Store, now time.Time) ([]staleAccount, error) {
+	h.mu.Lock()
+	schedule, accounts, started := h.schedule, h.accounts, h.started
+	lastErrs := make(map[string]error)
+	for account, b := range h.breakers {
+		lastErrs[account] = b.lastErr
+	}
+	h.mu.Unlock()
+	if schedule == nil {
+		return nil, nil
+	}
+
+	var stale []staleAccount
+	for _, account := range accounts {
+		value, err := db.Status(ctx, "last_check:"+account)
+		if err != nil {
+			return nil, err
+		}
+		since := started
+		lastCheck, err := time.Parse(time.RFC3339, value)
+		if err == nil && lastCheck.After(since) {
+			since = lastCheck
+		}
+		deadline := schedule.Next(schedule.Next(since)).Add(schedule.jitter + staleGrace)
+		if now.Before(deadline) {
+			continue
+		}
+		s := staleAccount{Account: account, LastCheck: value}
+		if lastErrs[account] != nil {
+			s.LastError = lastErrs[account].Error()
+		}
+		stale = append(stale, s)
+	}
+	return stale, nil
+}
+
+// watchdog queues a single alert for every account that has gone stale.
+// Further alerts are suppressed until the account is checked successfully
+// again (see clearWatchdogAlert).
+func watchdog(ctx context.Context, db Store, accounts []Account) {
+	stale, err := health.stale(ctx, db, time.Now())
+	if err != nil {
+		slog.Error("Watchdog failed", "err", err)
+		return
+	}
+	for _, s := range stale {
+		i := accountIndex(accounts, s.Account)
+		if i < 0 {
+			continue
+		}
+		acc := accounts[i]
+
+		err := db.Tx(ctx, func(tx Store) error {
+			alerted, err := tx.Status(ctx, "watchdog_alert:"+acc.Name)
+			if err != nil || alerted != "" {
+				return err
+			}
+
+			since := "the bot started"
+			if s.LastCheck != "" {
+				since = s.LastCheck
+			}
+			msg := fmt.Sprintf("%sWatchdog: no successful grade check since %s.", acc.Label(), since)
+			if s.LastError != "" {
+				msg += " Last error: " + s.LastError
+			}
+			slog.Warn("No successful check for too long", "account", acc.Name, "last_check", s.LastCheck, "last_error", s.LastError)
+			if err := enqueueNotification(ctx, tx, acc, msg); err != nil {
+				return err
+			}
+			return tx.SetStatus(ctx, "watchdog_alert:"+acc.Name, now())
+		})
+		if err != nil {
+			slog.Error("Error storing watchdog alert", "account", acc.Name, "err", err)
+		}
+	}
+}
+
+// clearWatchdogAlert re-arms the watchdog after a successful check and
+// queues an all-clear if it had alerted.
+func clearWatchdogAlert(ctx context.Context, tx Store, acc Account) error {
+	alerted, err := tx.DeleteStatus(ctx, "watchdog_alert:"+acc.Name)
+	if err != nil {
+		return err
+	}
+	if alerted {
+		return enqueueNotification(ctx, tx, acc, acc.Label()+"Watchdog: grade checks are working again.")
+	}
+	return nil
+}
+
+func accountIndex(accounts []Account, name string) int {
+	for i, acc := range accounts {
+		if acc.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// healthz reports that the process is alive.
+func (a *api) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyz reports whether the bot is working: the database is reachable,
+// every account was checked successfully within two planned runs and no
+// account's checks are paused. It responds 503 otherwise.
+func (a *api) readyz(w http.ResponseWriter, r *http.Request) {
+	type result struct {
+		Ready    bool           `json:"ready"`
+		Database string         `json:"database"`
+		Stale    []staleAccount `json:"stale"`
+		Paused   []string       `json:"paused"`
+	}
+	res := result{Database: "ok", Stale: []staleAccount{}, Paused: []string{}}
+
+	now := time.Now()
+	stale, err := a.health.stale(r.Context(), a.db, now)
+	if err == nil {
+		err = a.db.Ping(r.Context())
+	}
+	if err != nil {
+		res.Database = err.Error()
+	}
+	if stale != nil {
+		res.Stale = stale
+	}
+	if open := a.health.openBreakers(now); open != nil {
+		res.Paused = open
+	}
+
+	res.Ready = err == nil && len(res.Stale) == 0 && len(res.Paused) == 0
+	status := http.StatusOK
+	if !res.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, res)
+}
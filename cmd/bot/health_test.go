@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	h := newHealthState()
+	start := time.Date(2026, 7, 2, 12, 0, 0, 0, time.UTC)
+	fail := errors.New("login failed")
+
+	for i := 0; i < breakerThreshold-1; i++ {
+		h.record("default", fail, start)
+	}
+	if err := h.allow("default", start); err != nil {
+		t.Fatalf("paused after %d failures: %v", breakerThreshold-1, err)
+	}
+	h.record("default", fail, start)
+	if err := h.allow("default", start.Add(time.Minute)); !errors.Is(err, errCircuitOpen) || !errors.Is(err, fail) {
+		t.Fatalf("allow = %v, want paused with the last error", err)
+	}
+	if open := h.openBreakers(start); len(open) != 1 {
+		t.Errorf("open breakers = %v", open)
+	}
+
+	// After the cooldown one check is tried; a failure pauses again
+	retry := start.Add(breakerCooldown)
+	if err := h.allow("default", retry); err != nil {
+		t.Fatalf("still paused after the cooldown: %v", err)
+	}
+	h.record("default", fail, retry)
+	if err := h.allow("default", retry.Add(time.Minute)); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("allow = %v after a failed retry, want paused", err)
+	}
+
+	h.record("default", nil, retry.Add(breakerCooldown))
+	if err := h.allow("default", retry.Add(breakerCooldown)); err != nil {
+		t.Errorf("still paused after a successful check: %v", err)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		saved := health
+		defer func() { health = saved }()
+		health = newHealthState()
+		health.started = time.Now().Add(-time.Hour)
+		health.watch(&plan{base: every(10 * time.Minute)}, []Account{{Name: "default"}, {Name: "other"}})
+		if err := db.SetStatus(context.Background(), "last_check:default", time.Now().Add(-time.Minute).Format(time.RFC3339)); err != nil {
+			t.Fatal(err)
+		}
+		health.record("other", errors.New("login failed"), time.Now())
+
+		srv := httptest.NewServer(newAPI(db, "secret", ""))
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/healthz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("healthz: status %d", resp.StatusCode)
+		}
+
+		resp, err = http.Get(srv.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var ready struct {
+			Ready bool
+			Stale []staleAccount
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&ready); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable || ready.Ready {
+			t.Errorf("readyz: status %d, ready %v", resp.StatusCode, ready.Ready)
+		}
+		if len(ready.Stale) != 1 || ready.Stale[0].Account != "other" || ready.Stale[0].LastError != "login failed" {
+			t.Errorf("stale = %+v, want only other", ready.Stale)
+		}
+
+		// The watchdog alerts once per stale account
+		for i := 0; i < 2; i++ {
+			watchdog(context.Background(), db, []Account{{Name: "other", Notify: NotifySettings{DiscordEnabled: true, DiscordWebhookURL: "https://example.invalid"}}})
+		}
+		var queued int
+		db.(*sqlStore).queryRow(context.Background(), "SELECT COUNT(*) FROM outbox WHERE account = 'other' AND backend = 'discord-webhook'").Scan(&queued)
+		if queued != 1 {
+			t.Errorf("watchdog queued %d notifications, want 1", queued)
+		}
+	})
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snapshot is a historical transcript to import.
+type snapshot struct {
+	Path   string
+	Date   time.Time
+	Grades []Grade
+}
+
+var (
+	// reFileDate finds a date like 2024-03-01, 2024_03_01 or 20240301 in a
+	// file name, reFileDateDE one like 01.03.2024.
+	reFileDate   = regexp.MustCompile(`(?:^|\D)(\d{4})[-_.]?(\d{2})[-_.]?(\d{2})(?:\D|$)`)
+	reFileDateDE = regexp.MustCompile(`(?:^|\D)(\d{2})\.(\d{2})\.(\d{4})(?:\D|$)`)
+	// rePDFDate is a PDF date string (ISO 32000-1, section 7.9.4), e.g.
+	// D:20240301093012+01'00'.
+	rePDFDate = regexp.MustCompile(`^D:(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?([Zz+-])?(\d{2})?'?(\d{2})?`)
+)
+
+// snapshotDate returns when a transcript was downloaded: its creation date,
+// which CIS sets when generating it, or else a date in its file name (at
+// noon, as the time is unknown).
+func snapshotDate(path string) (time.Time, error) {
+	if t, ok := pdfCreationDate(path); ok {
+		return t, nil
+	}
+	if t, ok := fileNameDate(filepath.Base(path)); ok {
+		return t, nil
+	}
+	return time.Time{}, errors.New("no creation date in the PDF and no date in the file name")
+}
+
+func pdfCreationDate(path string) (_ time.Time, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	r, err := openPdf(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsePDFDate(r.Trailer().Key("Info").Key("CreationDate").Text())
+}
+
+func parsePDFDate(s string) (time.Time, bool) {
+	m := rePDFDate.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	n := func(i, def int) int {
+		if v, err := strconv.Atoi(m[i]); err == nil {
+			return v
+		}
+		return def
+	}
+	loc := time.Local
+	if m[7] == "Z" || m[7] == "z" {
+		loc = time.UTC
+	} else if m[7] != "" {
+		offset := n(8, 0)*3600 + n(9, 0)*60
+		if m[7] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	t := time.Date(n(1, 0), time.Month(n(2, 1)), n(3, 1), n(4, 0), n(5, 0), n(6, 0), 0, loc)
+	return t, t.Year() > 1990
+}
+
+func fileNameDate(name string) (time.Time, bool) {
+	var y, m, d string
+	if match := reFileDate.FindStringSubmatch(name); match != nil {
+		y, m, d = match[1], match[2], match[3]
+	} else if match := reFileDateDE.FindStringSubmatch(name); match != nil {
+		y, m, d = match[3], match[2], match[1]
+	} else {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(time.DateOnly, y+"-"+m+"-"+d, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t.Add(12 * time.Hour), true
+}
+
+// importStats summarises an import.
+type importStats struct {
+	Imported, Skipped int
+	Events            int
+}
+
+// importHistory rebuilds the history of an account from transcripts, as if
+// the bot had checked each of them on its date:
+//
+//   - The first transcript is the initial sync; later ones add "new",
+//     "changed" and "removed" events dated like the transcript.
+//   - Transcripts from after the first change the bot noticed itself are
+//     skipped, that history is already recorded.
+//   - The silent events of the bot's own initial sync are dropped where the
+//     imported history explains the grade, and become changes otherwise.
+//   - An account without grades gets the state of the last transcript, so
+//     the next check reports what changed since then.
+//
+// Nothing is notified. The account's events are rewritten in date order.
+func importHistory(ctx context.Context, db Store, acc Account, snaps []snapshot) (importStats, error) {
+	var stats importStats
+	err := db.Tx(ctx, func(tx Store) error {
+		var err error
+		stats, err = replaySnapshots(ctx, tx, acc, snaps)
+		return err
+	})
+	return stats, err
+}
+
+// replaySnapshots does the work of importHistory in its transaction.
+func replaySnapshots(ctx context.Context, tx Store, acc Account, snaps []snapshot) (importStats, error) {
+	var stats importStats
+	existing, err := tx.AccountEvents(ctx, acc.Name)
+	if err != nil {
+		return stats, err
+	}
+	rows, err := tx.Grades(ctx, acc.Name, "")
+	if err != nil {
+		return stats, err
+	}
+	stored := make(map[Grade]bool)
+	for _, g := range rows {
+		stored[Grade{Module: g.Module, OccurrenceIndex: g.OccurrenceIndex}] = true
+	}
+
+	var cutoff, botStart time.Time
+	for _, e := range existing {
+		t, _ := time.Parse(time.RFC3339, e.Time)
+		if !e.Silent && (cutoff.IsZero() || t.Before(cutoff)) {
+			cutoff = t
+		}
+		if e.Silent && t.After(botStart) {
+			botStart = t
+		}
+	}
+
+	// Replay the transcripts
+	type state struct {
+		grade   string
+		removed bool
+		time    string
+	}
+	grades := make(map[Grade]*state)
+	var events []GradeEvent
+	first := true
+	for _, s := range snaps {
+		if !cutoff.IsZero() && !s.Date.Before(cutoff) {
+			stats.Skipped++
+			continue
+		}
+		if problems := checkSnapshot(len(grades), s.Grades); len(problems) > 0 {
+			slog.Warn("Skipping a transcript that looks wrong", "file", s.Path, "problems", strings.Join(problems, "; "))
+			stats.Skipped++
+			continue
+		}
+		var previous []string
+		for key := range grades {
+			previous = append(previous, key.Module)
+		}
+		resolved, err := resolveModules(ctx, tx, s.Grades, previous)
+		if err != nil {
+			return stats, err
+		}
+		stats.Imported++
+		at := s.Date.Format(time.RFC3339)
+		event := func(e GradeEvent) {
+			e.Account, e.Time, e.Silent = acc.Name, at, first
+			events = append(events, e)
+		}
+		seen := make(map[Grade]bool)
+		for _, g := range resolved {
+			key := Grade{Module: g.Module, OccurrenceIndex: g.OccurrenceIndex}
+			seen[key] = true
+			switch cur := grades[key]; {
+			case cur == nil || cur.removed:
+				grades[key] = &state{grade: g.Grade, time: at}
+				event(GradeEvent{Type: eventNew, Module: g.Module, OccurrenceIndex: g.OccurrenceIndex, Grade: g.Grade})
+			case cur.grade != g.Grade:
+				event(GradeEvent{Type: eventChanged, Module: g.Module, OccurrenceIndex: g.OccurrenceIndex, Grade: g.Grade, PreviousGrade: cur.grade})
+				cur.grade, cur.time = g.Grade, at
+			}
+		}
+		for key, cur := range grades {
+			if !seen[key] && !cur.removed {
+				event(GradeEvent{Type: eventRemoved, Module: key.Module, OccurrenceIndex: key.OccurrenceIndex, PreviousGrade: cur.grade})
+				cur.removed, cur.time = true, at
+			}
+		}
+		first = false
+	}
+	if stats.Imported == 0 {
+		return stats, nil
+	}
+
+	// Merge with the recorded history
+	for _, e := range existing {
+		key := Grade{Module: e.Module, OccurrenceIndex: e.OccurrenceIndex}
+		if cur := grades[key]; e.Silent && e.Type == eventNew && cur != nil {
+			if !cur.removed && cur.grade == e.Grade {
+				continue
+			}
+			if !cur.removed {
+				e.Type, e.PreviousGrade = eventChanged, cur.grade
+			}
+		}
+		events = append(events, e)
+	}
+	if len(stored) == 0 {
+		for key, cur := range grades {
+			status := eventNew
+			if cur.removed {
+				status = eventRemoved
+			}
+			if err := tx.InsertGrade(ctx, storedGrade{Account: acc.Name, Module: key.Module, Grade: cur.grade,
+				OccurrenceIndex: key.OccurrenceIndex, Status: status, UpdatedAt: cur.time}); err != nil {
+				return stats, err
+			}
+		}
+	} else {
+		// Grades that were gone before the bot started are kept as removed
+		at := cmp.Or(botStart, snaps[len(snaps)-1].Date).Format(time.RFC3339)
+		for key, cur := range grades {
+			if stored[key] {
+				continue
+			}
+			if err := tx.InsertGrade(ctx, storedGrade{Account: acc.Name, Module: key.Module, Grade: cur.grade,
+				OccurrenceIndex: key.OccurrenceIndex, Status: eventRemoved, UpdatedAt: at}); err != nil {
+				return stats, err
+			}
+			if !cur.removed {
+				events = append(events, GradeEvent{Account: acc.Name, Type: eventRemoved, Module: key.Module,
+					OccurrenceIndex: key.OccurrenceIndex, PreviousGrade: cur.grade, Time: at})
+			}
+		}
+	}
+
+	slices.SortStableFunc(events, func(a, b GradeEvent) int {
+		ta, _ := time.Parse(time.RFC3339, a.Time)
+		tb, _ := time.Parse(time.RFC3339, b.Time)
+		return ta.Compare(tb)
+	})
+	if err := tx.ReplaceEvents(ctx, acc.Name, events); err != nil {
+		return stats, err
+	}
+	stats.Events = len(events)
+	return stats, nil
+}
+
+func cmdImport(args []string) int {
+	fs := newFlagSet("import")
+	account := fs.String("account", "", "import into this account (required with several accounts)")
+	dryRun := fs.Bool("dry-run", false, "only list the transcripts in the order they would be imported")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	accounts, err := selectAccounts(*account)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if len(accounts) > 1 {
+		fmt.Fprintln(os.Stderr, "choose the account to import into with --account")
+		return exitUsage
+	}
+	acc := accounts[0]
+
+	entries, err := os.ReadDir(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	var snaps []snapshot
+	failed := false
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".pdf") {
+			continue
+		}
+		path := filepath.Join(fs.Arg(0), e.Name())
+		date, err := snapshotDate(path)
+		if err == nil {
+			var grades []Grade
+			if grades, err = parsePdf(path, ""); err == nil {
+				snaps = append(snaps, snapshot{path, date, grades})
+				continue
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		failed = true
+	}
+	if failed {
+		fmt.Fprintln(os.Stderr, "Rename the files to include their date (e.g. 2024-03-01.pdf) or move them out of the directory.")
+		return exitError
+	}
+	if len(snaps) == 0 {
+		fmt.Fprintln(os.Stderr, "No PDF files found.")
+		return exitError
+	}
+	slices.SortStableFunc(snaps, func(a, b snapshot) int { return a.Date.Compare(b.Date) })
+
+	if *dryRun {
+		for _, s := range snaps {
+			fmt.Printf("%s  %3d grades  %s\n", s.Date.Format("2006-01-02 15:04"), len(s.Grades), s.Path)
+		}
+		return exitOK
+	}
+
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer db.Close()
+	inst, err := acquireInstance(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer inst.Release()
+
+	stats, err := importHistory(context.Background(), db, acc, snaps)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Printf("Imported %d transcripts, skipped %d; the history of %s now has %d events.\n",
+		stats.Imported, stats.Skipped, acc.Name, stats.Events)
+	if stats.Skipped > 0 {
+		fmt.Println("Transcripts from after the bot's first noticed change, or that looked wrong, were skipped.")
+	}
+	return exitOK
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnapshotDates(t *testing.T) {
+	for name, want := range map[string]string{
+		"Notenuebersicht_2024-03-01.pdf": "2024-03-01",
+		"grades_20240301.pdf":            "2024-03-01",
+		"Notenspiegel 01.03.2024.pdf":    "2024-03-01",
+		"2024_03_01-final.pdf":           "2024-03-01",
+	} {
+		got, ok := fileNameDate(name)
+		if !ok || got.Format(time.DateOnly) != want {
+			t.Errorf("fileNameDate(%q) = %v, %v, want %s", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"grades.pdf", "grades_2024-13-45.pdf", "scan123456.pdf"} {
+		if got, ok := fileNameDate(name); ok {
+			t.Errorf("fileNameDate(%q) = %v, want no date", name, got)
+		}
+	}
+
+	got, ok := parsePDFDate("D:20240301093012+01'00'")
+	if want := time.Date(2024, 3, 1, 8, 30, 12, 0, time.UTC); !ok || !got.Equal(want) {
+		t.Errorf("parsePDFDate = %v, %v, want %v", got, ok, want)
+	}
+	if _, ok := parsePDFDate("yesterday"); ok {
+		t.Error("parsePDFDate accepted an invalid date")
+	}
+}
+
+func TestImportHistory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		// The bot started on March 1st and noticed a change on April 1st
+		ctx := context.Background()
+		for _, g := range []storedGrade{
+			{Account: "default", Module: "Analysis", Grade: "1,3", Status: eventNew, UpdatedAt: "2026-03-01T12:00:00Z"},
+			{Account: "default", Module: "Biologie", Grade: "1,7", Status: eventNew, UpdatedAt: "2026-04-01T12:00:00Z"},
+		} {
+			if err := db.InsertGrade(ctx, g); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, e := range []GradeEvent{
+			{Type: eventNew, Module: "Analysis", Grade: "1,3", Silent: true, Time: "2026-03-01T12:00:00Z"},
+			{Type: eventNew, Module: "Biologie", Grade: "2,0", Silent: true, Time: "2026-03-01T12:00:00Z"},
+			{Type: eventChanged, Module: "Biologie", Grade: "1,7", PreviousGrade: "2,0", Time: "2026-04-01T12:00:00Z"},
+		} {
+			e.Account = "default"
+			if err := db.AddEvent(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		date := func(s string) time.Time {
+			d, _ := time.Parse(time.DateOnly, s)
+			return d.Add(12 * time.Hour)
+		}
+		snaps := []snapshot{
+			{"a.pdf", date("2025-10-01"), []Grade{{Module: "Analysis", Grade: "#"}}},
+			{"b.pdf", date("2026-01-15"), []Grade{{Module: "Analysis", Grade: "1,3"}, {Module: "Chemie", Grade: "3,0"}}},
+			{"c.pdf", date("2026-05-01"), []Grade{{Module: "Analysis", Grade: "1,3"}}},
+		}
+		stats, err := importHistory(ctx, db, Account{Name: defaultAccount}, snaps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Imported != 2 || stats.Skipped != 1 {
+			t.Errorf("stats = %+v", stats)
+		}
+
+		events, err := db.AccountEvents(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range events {
+			got = append(got, fmt.Sprintf("%s %s %s %s->%s silent=%v", e.Time[:10], e.Module, e.Type, e.PreviousGrade, e.Grade, e.Silent))
+		}
+		want := []string{
+			"2025-10-01 Analysis new -># silent=true",
+			"2026-01-15 Analysis changed #->1,3 silent=false",
+			"2026-01-15 Chemie new ->3,0 silent=false",
+			"2026-03-01 Biologie new ->2,0 silent=true",
+			"2026-03-01 Chemie removed 3,0-> silent=false",
+			"2026-04-01 Biologie changed 2,0->1,7 silent=false",
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("events:\n%q\nwant:\n%q", got, want)
+		}
+
+		if grades, err := db.Grades(ctx, "", "Chemie"); err != nil || len(grades) != 1 || grades[0].Status != eventRemoved {
+			t.Errorf("Chemie: %+v, %v", grades, err)
+		}
+	})
+}
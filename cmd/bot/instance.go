@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lockFile = "gradechecker.lock"
+
+	// leaseDuration is how long the database lease stays valid without
+	// renewal. It is renewed every leaseDuration/4.
+	leaseDuration = 2 * time.Minute
+)
+
+// errLocked is returned when another instance is running.
+var errLocked = errors.New("another gradechecker instance is running")
+
+// instance guards against two bots working on the same data. The lock file
+// catches a second process in the same directory; the lease in
+// system_status also catches one using the same database through another
+// path, e.g. a network share or a container volume.
+type instance struct {
+	db   Store
+	id   string
+	done chan struct{}
+	// lost is closed when the lease was taken over by another instance.
+	lost chan struct{}
+}
+
+// acquireInstance takes the lock file and the database lease and keeps the
+// lease renewed until Release.
+func acquireInstance(db Store) (*instance, error) {
+	if err := acquireLockFile(lockFile); err != nil {
+		return nil, err
+	}
+
+	inst := &instance{
+		db:   db,
+		id:   instanceID(),
+		done: make(chan struct{}),
+		lost: make(chan struct{}),
+	}
+	if err := acquireLease(context.Background(), db, inst.id, time.Now()); err != nil {
+		os.Remove(lockFile)
+		return nil, err
+	}
+
+	go inst.renew()
+	return inst, nil
+}
+
+// instanceID identifies this process as a lease holder ("host:pid").
+func instanceID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// acquireLease takes the database lease for id. Like a stale lock file, a
+// lease left behind by a process of this host that no longer runs (after
+// a crash or a hard kill) is taken over instead of waiting for it to
+// expire.
+func acquireLease(ctx context.Context, db Store, id string, at time.Time) error {
+	err := db.AcquireLease(ctx, id, at)
+	if !errors.Is(err, errLocked) {
+		return err
+	}
+	holder, serr := db.Status(ctx, "leader")
+	if serr != nil || !staleHolder(holder) {
+		return err
+	}
+	slog.Warn("Taking over the database lease of a stopped instance", "holder", holder)
+	if err := db.ReleaseLease(ctx, holder); err != nil {
+		return err
+	}
+	return db.AcquireLease(ctx, id, at)
+}
+
+// staleHolder reports whether a lease holder ("host:pid") is a process of
+// this host that no longer runs.
+func staleHolder(holder string) bool {
+	i := strings.LastIndex(holder, ":")
+	if i < 0 {
+		return false
+	}
+	host, _ := os.Hostname()
+	pid, err := strconv.Atoi(holder[i+1:])
+	return err == nil && holder[:i] == host && pid != os.Getpid() && !processAlive(pid)
+}
+
+// Lost is closed when the instance no longer holds the database lease.
+func (inst *instance) Lost() <-chan struct{} {
+	return inst.lost
+}
+
+func (inst *instance) renew() {
+	ticker := time.NewTicker(leaseDuration / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-inst.done:
+			return
+		case <-ticker.C:
+			err := inst.db.AcquireLease(context.Background(), inst.id, time.Now())
+			if errors.Is(err, errLocked) {
+				slog.Error("Lost the database lease", "err", err)
+				close(inst.lost)
+				return
+			}
+			if err != nil {
+				slog.Warn("Error renewing database lease", "err", err)
+			}
+		}
+	}
+}
+
+// Release gives up the lease and removes the lock file.
+func (inst *instance) Release() {
+	close(inst.done)
+	if err := inst.db.ReleaseLease(context.Background(), inst.id); err != nil {
+		slog.Warn("Error releasing database lease", "err", err)
+	}
+	os.Remove(lockFile)
+}
+
+// acquireLockFile creates the lock file with our PID. A lock file left
+// behind by a process that no longer runs is replaced.
+func acquireLockFile(path string) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("creating lock file: %w", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading lock file: %w", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && pid != os.Getpid() && processAlive(pid) {
+			abs, _ := filepath.Abs(path)
+			return fmt.Errorf("%w (PID %d, lock file %s); stop it first, or delete the lock file if it is not running", errLocked, pid, abs)
+		}
+		slog.Warn("Removing stale lock file", "path", path, "pid", strings.TrimSpace(string(data)))
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing stale lock file: %w", err)
+		}
+	}
+	return fmt.Errorf("%w: could not take over the lock file %s", errLocked, path)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAcquireLease(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		start := time.Now()
+		if err := db.AcquireLease(ctx, "a", start); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AcquireLease(ctx, "a", start.Add(time.Minute)); err != nil {
+			t.Errorf("renewing own lease: %v", err)
+		}
+		if err := db.AcquireLease(ctx, "b", start.Add(2*time.Minute)); !errors.Is(err, errLocked) {
+			t.Errorf("second instance got %v, want errLocked", err)
+		}
+		// The lease of a dead instance expires
+		if err := db.AcquireLease(ctx, "b", start.Add(time.Minute+leaseDuration+time.Second)); err != nil {
+			t.Errorf("taking over an expired lease: %v", err)
+		}
+	})
+}
+
+func TestAcquireLeaseOfStoppedInstance(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		host, _ := os.Hostname()
+		now := time.Now()
+
+		// The parent process (the test runner) is alive, and a process of
+		// another host cannot be checked
+		for _, holder := range []string{host + ":" + strconv.Itoa(os.Getppid()), "elsewhere:999999999"} {
+			if err := db.AcquireLease(ctx, holder, now); err != nil {
+				t.Fatal(err)
+			}
+			if err := acquireLease(ctx, db, "me", now); !errors.Is(err, errLocked) {
+				t.Errorf("lease of %s: got %v, want errLocked", holder, err)
+			}
+			if err := db.ReleaseLease(ctx, holder); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// A process of this host that no longer exists left its lease behind
+		if err := db.AcquireLease(ctx, host+":999999999", now); err != nil {
+			t.Fatal(err)
+		}
+		if err := acquireLease(ctx, db, "me", now); err != nil {
+			t.Fatalf("taking over the lease of a stopped instance: %v", err)
+		}
+		if holder, _ := db.Status(ctx, "leader"); holder != "me" {
+			t.Errorf("lease held by %q", holder)
+		}
+	})
+}
+
+func TestAcquireLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockFile)
+
+	// A lock file of a process that no longer exists is stale
+	if err := os.WriteFile(path, []byte("999999999\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := acquireLockFile(path); err != nil {
+		t.Fatalf("stale lock file: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Errorf("lock file contains %q", data)
+	}
+
+	// The parent process (the test runner) is alive
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := acquireLockFile(path); !errors.Is(err, errLocked) {
+		t.Errorf("live lock file: got %v, want errLocked", err)
+	}
+}
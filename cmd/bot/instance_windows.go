@@ -0,0 +1,14 @@
+package main
+
+import "os"
+
+// processAlive reports whether a process with the given PID exists.
+// On Windows FindProcess opens the process and fails if there is none.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gradechecker/pkg/config"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// logLevel is the level of all log output; reloaded on SIGHUP.
+var logLevel = new(slog.LevelVar)
+
+// setupLogging installs the default logger as configured (see config.Log):
+// text or JSON lines on stderr, optionally copied to a rotating log file.
+//
+// All output, including the log events streamed by the API, passes the
+// secret redaction. The returned function closes the log file.
+func setupLogging(cfg config.Log) func() {
+	setLogLevel(cfg.Level)
+	secrets.refresh()
+
+	w := io.Writer(os.Stderr)
+	closeFile := func() {}
+	var fileErr error
+	if cfg.File != "" {
+		f, err := openRotatingFile(cfg.File, int64(cfg.MaxSize)<<20, cfg.MaxBackups)
+		if err != nil {
+			fileErr = err
+		} else {
+			w = io.MultiWriter(os.Stderr, f)
+			closeFile = func() { f.Close() }
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+	out := slog.Handler(slog.NewTextHandler(w, opts))
+	if cfg.Format == "json" {
+		out = slog.NewJSONHandler(w, opts)
+	}
+	// Log output is also streamed by the API
+	slog.SetDefault(slog.New(redactHandler{fanoutHandler{out, slog.NewJSONHandler(bus, opts)}}))
+
+	if fileErr != nil {
+		slog.Warn("Cannot open the log file", "file", cfg.File, "err", fileErr)
+	}
+	return closeFile
+}
+
+// setLogLevel applies a level validated by the config package; anything
+// else means info.
+func setLogLevel(level string) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		l = slog.LevelInfo
+	}
+	logLevel.Set(l)
+}
+
+// reloadLogging applies a changed level and picks up changed secrets. The
+// format and log file only change on restart.
+func reloadLogging(cfg *config.Config) {
+	setLogLevel(cfg.Log.Level)
+	secrets.refresh()
+}
+
+// fanoutHandler passes every record to all its handlers.
+type fanoutHandler []slog.Handler
+
+func (f fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// redactHandler removes secrets from the message and attributes of every
+// record before passing it on.
+type redactHandler struct {
+	next slog.Handler
+}
+
+func (h redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, secrets.redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = redactAttr(a)
+	}
+	return redactHandler{h.next.WithAttrs(clean)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.next.WithGroup(name)}
+}
+
+// redactAttr redacts string values; other values that are not plain
+// numbers, times or booleans (such as errors) are turned into strings first.
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, secrets.redact(v.String()))
+	case slog.KindAny:
+		return slog.String(a.Key, secrets.redact(fmt.Sprint(v.Any())))
+	case slog.KindGroup:
+		group := v.Group()
+		clean := make([]any, len(group))
+		for i, g := range group {
+			clean[i] = redactAttr(g)
+		}
+		return slog.Group(a.Key, clean...)
+	default:
+		return slog.Attr{Key: a.Key, Value: v}
+	}
+}
+
+// secretPatterns match secrets by their shape. The first group is kept.
+var secretPatterns = []*regexp.Regexp{
+	// Discord webhook URLs contain the webhook token
+	regexp.MustCompile(`(https?://(?:[\w-]+\.)?discord(?:app)?\.com/api/(?:v\d+/)?webhooks/)[^\s"'<>]+`),
+	// Discord bot tokens
+	regexp.MustCompile(`()\b[MNO][\w-]{23,27}\.[\w-]{6}\.[\w-]{27,}`),
+	// Authorization header values
+	regexp.MustCompile(`(\b(?:Bot|Bearer|Basic) )[\w.~+/=-]{16,}`),
+	// Cookie headers and session cookies (CIS is TYPO3)
+	regexp.MustCompile(`(?i)(\b(?:set-)?cookie:\s*)[^\r\n]+`),
+	regexp.MustCompile(`(?i)(\b(?:fe_typo_user|be_typo_user|PHPSESSID|JSESSIONID|session(?:id)?)=)[^;\s"'&]+`),
+	// Form-encoded passwords
+	regexp.MustCompile(`(?i)(\b(?:pass|password|passwd)=)[^&\s"']+`),
+}
+
+// secretEnvKeys are the parts of environment variable names whose values
+// are secrets, e.g. CIS_PASSWORD_ALICE or DISCORD_BOT_TOKEN.
+var secretEnvKeys = []string{"PASSWORD", "PASSPHRASE", "TOKEN", "SECRET", "WEBHOOK_URL"}
+
+// minSecretLength keeps short values like "1" from being redacted everywhere.
+const minSecretLength = 4
+
+// redactor knows the secret values that must never be logged.
+type redactor struct {
+	mu sync.RWMutex
+	// env holds the secrets from the environment, added those registered
+	// with add.
+	env, added []string
+}
+
+// secrets redacts all log output.
+var secrets = &redactor{}
+
+// refresh rereads the secrets from the environment.
+func (r *redactor) refresh() {
+	var values []string
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		for _, part := range secretEnvKeys {
+			if strings.Contains(strings.ToUpper(key), part) {
+				values = append(values, secretForms(value)...)
+				break
+			}
+		}
+	}
+	r.mu.Lock()
+	r.env = values
+	r.mu.Unlock()
+}
+
+// add registers a secret that does not come from the environment.
+func (r *redactor) add(secret string) {
+	forms := secretForms(secret)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range forms {
+		if !slices.Contains(r.added, f) {
+			r.added = append(r.added, f)
+		}
+	}
+}
+
+// secretForms returns the secret as is and URL-encoded, as it appears in
+// form posts.
+func secretForms(secret string) []string {
+	secret = strings.TrimSpace(secret)
+	if len(secret) < minSecretLength {
+		return nil
+	}
+	forms := []string{secret}
+	if enc := url.QueryEscape(secret); enc != secret {
+		forms = append(forms, enc)
+	}
+	return forms
+}
+
+// redact replaces all secrets in s.
+func (r *redactor) redact(s string) string {
+	r.mu.RLock()
+	for _, list := range [][]string{r.env, r.added} {
+		for _, secret := range list {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	r.mu.RUnlock()
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
+
+// rotatingFile is a log file that is renamed to FILE.1 when it grows
+// beyond maxSize; older files move on to FILE.2 and so on, up to backups.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	f       *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate closes the file before renaming it, which Windows requires.
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	r.f = nil
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.backups))
+	for i := r.backups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
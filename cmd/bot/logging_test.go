@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	t.Setenv("CIS_PASSWORD_ALICE", "hunter2&more")
+	secrets.refresh()
+	defer secrets.refresh()
+
+	var b strings.Builder
+	logger := slog.New(redactHandler{slog.NewTextHandler(&b, nil)})
+	logger.With("cookie", "fe_typo_user=abc123").Info("Login with pass=hunter2%26more",
+		"err", errors.New(`Post "https://discord.com/api/webhooks/123/s3cr3t-token": timeout`),
+		"header", "Authorization: Bot MTIzNDU2Nzg5MDEyMzQ1Njc4.GaBcDe.abcdefghijklmnopqrstuvwxyz0123",
+		"note", "password is hunter2&more")
+
+	out := b.String()
+	for _, secret := range []string{"hunter2", "abc123", "s3cr3t-token", "MTIzNDU2Nzg5MDEyMzQ1Njc4"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%q not redacted in %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "https://discord.com/api/webhooks/[REDACTED]") {
+		t.Errorf("webhook URL prefix should be kept: %s", out)
+	}
+}
+
+func TestNotificationNotLogged(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	var b strings.Builder
+	defer func(orig *slog.Logger) { slog.SetDefault(orig) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&b, nil)))
+
+	ns := NotifySettings{DiscordEnabled: true, DiscordWebhookURL: webhook.URL}
+	if err := notify(context.Background(), ns, "Mathematik I", "1,7"); err != nil {
+		t.Fatal(err)
+	}
+	if out := b.String(); strings.Contains(out, "Mathematik") || !strings.Contains(out, "backend=discord-webhook") {
+		t.Errorf("log = %s", out)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.log")
+	f, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more backups than configured: %v", err)
+	}
+}
@@ -2,18 +2,16 @@ package main
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
 	"gradechecker/pkg/integrity"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
-	"os/exec"
-	"regexp"
+	"os/signal"
 	"strconv"
 	"strings"
 	"time"
@@ -21,11 +19,7 @@ import (
 	"unicode"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/joho/godotenv"
-	"github.com/ledongthuc/pdf"
-	"golang.org/x/net/publicsuffix"
 	"golang.org/x/text/unicode/norm"
-	_ "modernc.org/sqlite"
 )
 
 const (
@@ -35,9 +29,9 @@ const (
 )
 
 type Grade struct {
-	Module          string
-	Grade           string
-	OccurrenceIndex int
+	Module          string `json:"module"`
+	Grade           string `json:"grade"`
+	OccurrenceIndex int    `json:"occurrence_index"`
 }
 
 type VersionConfig struct {
@@ -51,31 +45,34 @@ type GitHubRelease struct {
 }
 
 func main() {
-	// Check for test flag
-	if len(os.Args) > 1 && os.Args[1] == "--test" {
-		godotenv.Load()
-		log.Println("Sending test notification...")
-		err := notify("System", "Test Notification - GradeChecker is working!")
-		if err != nil {
-			log.Fatalf("Test failed: %v", err)
-		}
-		log.Println("Test notification sent successfully.")
-		return
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// runDaemon starts the bot: it records the integrity status, checks for
+// updates and then checks all accounts in a loop.
+func runDaemon(account string) int {
+	// Init DB
+	db, err := openDB()
+	if err != nil {
+		slog.Error("Cannot open the database", "err", err)
+		return exitError
 	}
+	defer db.Close()
 
-	// Load .env
-	godotenv.Load()
+	inst, err := acquireInstance(db)
+	if err != nil {
+		slog.Error("Cannot start", "err", err)
+		return exitError
+	}
+	defer inst.Release()
 
 	// Load Version
-	versionFile, err := os.ReadFile("version.json")
+	version, err := readVersion()
 	if err != nil {
-		log.Println("Warning: Could not read version.json:", err)
-	}
-	var versionConfig VersionConfig
-	if err == nil {
-		json.Unmarshal(versionFile, &versionConfig)
-		log.Printf("Starting GradeChecker v%s\n", versionConfig.Version)
-		go checkForUpdates(versionConfig.Version)
+		slog.Warn("Could not read version.json", "err", err)
+	} else {
+		slog.Info("Starting GradeChecker", "version", version)
+		go checkForUpdates(context.Background(), version)
 	}
 
 	// Integrity Check
@@ -84,264 +81,211 @@ func main() {
 	// Automatically update checksum file
 	updatedHash, err := integrity.UpdateChecksumFile(cwd)
 	if err != nil {
-		log.Printf("Warning: Failed to update checksum file: %v\n", err)
+		slog.Warn("Failed to update checksum file", "err", err)
 	} else {
-		log.Printf("Checksum file updated. New hash: %s\n", updatedHash)
+		slog.Info("Checksum file updated", "hash", updatedHash)
 	}
 
 	isOfficial, localHash, err := integrity.CheckIntegrity(cwd)
 	statusVal := "MODIFIED"
 	if err != nil {
-		log.Printf("Integrity Check Failed: %v\n", err)
+		slog.Error("Integrity check failed", "err", err)
 		statusVal = "ERROR"
 	} else if isOfficial {
-		log.Println("Integrity Check: OFFICIAL (Matches GitHub)")
+		slog.Info("Integrity check: OFFICIAL (matches GitHub)")
 		statusVal = "OFFICIAL"
 	} else {
-		log.Printf("Integrity Check: MODIFIED (Local: %s)\n", localHash)
-	}
-
-	// Init DB
-	db, err := sql.Open("sqlite", dbFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	// Create table if not exists - V2 Schema
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS grades_v2 (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		module_name TEXT NOT NULL,
-		grade TEXT,
-		occurrence_index INTEGER,
-		status TEXT,
-		updated_at TEXT,
-		UNIQUE(module_name, occurrence_index)
-	);`)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Create system_status table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS system_status (
-		key TEXT PRIMARY KEY,
-		value TEXT,
-		updated_at TEXT
-	);`)
-	if err != nil {
-		log.Fatal(err)
+		slog.Info("Integrity check: MODIFIED", "hash", localHash)
 	}
 
 	// Store Integrity Status
-	_, err = db.Exec(`INSERT INTO system_status (key, value, updated_at) 
-		VALUES ('integrity_status', ?, ?) 
-		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=excluded.updated_at`,
-		statusVal, time.Now().Format(time.RFC3339))
-	if err != nil {
-		log.Println("Error storing integrity status:", err)
+	if err := db.SetStatus(context.Background(), "integrity_status", statusVal); err != nil {
+		slog.Error("Error storing integrity status", "err", err)
 	}
 	if localHash != "" {
-		_, err = db.Exec(`INSERT INTO system_status (key, value, updated_at) 
-			VALUES ('integrity_hash', ?, ?) 
-			ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=excluded.updated_at`,
-			localHash, time.Now().Format(time.RFC3339))
-		if err != nil {
-			log.Println("Error storing integrity hash:", err)
+		if err := db.SetStatus(context.Background(), "integrity_hash", localHash); err != nil {
+			slog.Error("Error storing integrity hash", "err", err)
 		}
 	}
 
-	// Setup Client with CookieJar ONCE to persist session
-	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
-	if err != nil {
-		log.Fatal(err)
-	}
-	client := &http.Client{
-		Jar:     jar,
-		Timeout: 60 * time.Second,
-	}
-
-	for {
-		// Reload env to get fresh interval/credentials
-		godotenv.Load()
-		username := os.Getenv("CIS_USERNAME")
-		password := os.Getenv("CIS_PASSWORD")
-		intervalStr := os.Getenv("CHECK_INTERVAL")
-		customTranscriptURL := os.Getenv("TRANSCRIPT_URL")
-
-		targetURL := transcriptURL
-		if customTranscriptURL != "" {
-			targetURL = customTranscriptURL
-		}
-
-		interval := 60
-		if intervalStr != "" {
-			if val, err := strconv.Atoi(intervalStr); err == nil {
-				interval = val
-			}
-		}
-
-		if username == "" || password == "" {
-			log.Println("CIS_USERNAME and CIS_PASSWORD must be set in .env. Waiting...")
-			time.Sleep(1 * time.Minute)
-			continue
-		}
-
-		log.Println("Starting check cycle...")
-		checkGrades(db, client, username, password, targetURL)
-		log.Printf("Check finished. Sleeping for %d minutes.\n", interval)
+	stopAPI := startAPI(db, version, currentConfig().API)
+	defer stopAPI()
 
-		time.Sleep(time.Duration(interval) * time.Minute)
-	}
+	return checkLoop(db, account, inst.Lost())
 }
 
-func checkGrades(db *sql.DB, client *http.Client, username, password, targetURL string) {
-	// 1. Try to access transcript directly
-	log.Println("Checking session validity...")
-	resp, err := client.Get(targetURL)
-	if err != nil {
-		log.Println("Failed to access transcript URL:", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	// Check if we got the PDF or a login page
-	contentType := resp.Header.Get("Content-Type")
-	if !strings.Contains(contentType, "application/pdf") {
-		log.Println("Session expired or invalid (got HTML instead of PDF). Logging in...")
+// shutdownGrace is how long a running check may take to finish after a
+// shutdown signal before it is aborted.
+const shutdownGrace = 30 * time.Second
 
-		// Perform Login
-		if err := performLogin(client, username, password); err != nil {
-			log.Println("Login failed:", err)
-			return
-		}
+// daemonSignals delivers the process signals the daemon reacts to:
+// stop (SIGTERM, SIGINT) shuts it down, check (SIGUSR1) starts a check
+// right away and reload (SIGHUP) rereads .env and the configuration file.
+// Unsupported signals have a nil channel.
+type daemonSignals struct {
+	stop, check, reload chan os.Signal
+}
 
-		// Retry fetching transcript
-		log.Println("Retrying transcript download...")
-		resp, err = client.Get(targetURL)
-		if err != nil {
-			log.Println("Failed to download transcript after login:", err)
-			return
+// close stops delivering signals to the channels.
+func (s daemonSignals) close() {
+	for _, ch := range []chan os.Signal{s.stop, s.check, s.reload} {
+		if ch != nil {
+			signal.Stop(ch)
 		}
-		defer resp.Body.Close()
-	} else {
-		log.Println("Session is valid.")
-	}
-
-	if resp.StatusCode != 200 {
-		log.Printf("Failed to download transcript, status: %d\n", resp.StatusCode)
-		return
-	}
-
-	// Save PDF locally with progress
-	log.Println("Downloading PDF...")
-	pdfData, err := downloadWithProgress(resp)
-	if err != nil {
-		log.Println("Download failed:", err)
-		return
 	}
+}
 
-	err = os.WriteFile("grades.pdf", pdfData, 0644)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	log.Println("PDF downloaded successfully.")
+// checkRequests asks the check loop for an immediate check, like SIGUSR1.
+var checkRequests = make(chan struct{}, 1)
+
+// checkLoop checks the selected accounts (all if account is empty) right
+// away and then as planned by the schedule (see loadSchedule) until a
+// shutdown signal arrives or the instance lease is lost. Changes of the
+// configuration are picked up without a restart.
+func checkLoop(db Store, account string, lost <-chan struct{}) int {
+	sigs := notifySignals()
+	defer sigs.close()
+	return runLoop(db, account, lost, sigs)
+}
 
-	// Parse PDF
-	log.Println("Parsing PDF content...")
-	content, err := readPdf("grades.pdf")
-	if err != nil {
-		log.Println("Failed to read PDF:", err)
-		return
-	}
+// runLoop is checkLoop reacting to the given signal channels.
+func runLoop(db Store, account string, lost <-chan struct{}, sigs daemonSignals) int {
+
+	// On a shutdown signal the running check gets shutdownGrace to finish.
+	// After that, or on a second signal, it is cancelled: requests are
+	// aborted and the grade updates of the cycle are rolled back.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopping := make(chan struct{})
+	go func() {
+		sig := <-sigs.stop
+		slog.Info("Shutting down after the current check", "signal", sig.String())
+		close(stopping)
+		select {
+		case <-sigs.stop:
+		case <-time.After(shutdownGrace):
+		}
+		cancel()
+	}()
 
-	// Extract Grades and Compare
-	newGrades := extractGrades(content)
-	log.Printf("Found %d grades in PDF. Checking against database...\n", len(newGrades))
+	// One HTTP client per account, created once to persist sessions
+	clients := sessions{}
 
-	// Check if DB is empty (First Run)
-	var count int
-	err = db.QueryRow("SELECT count(*) FROM grades_v2").Scan(&count)
-	if err != nil {
-		log.Println("DB Error checking count:", err)
-		return
-	}
+	configChanged := watchConfig(stopping)
 
-	isFirstRun := count == 0
-	if isFirstRun {
-		log.Println("Database is empty. Performing initial silent sync...")
-	}
+	for {
+		schedule := loadScheduleOrDefault()
 
-	for _, g := range newGrades {
-		var exists int
-		err = db.QueryRow("SELECT count(*) FROM grades_v2 WHERE module_name = ? AND occurrence_index = ?", g.Module, g.OccurrenceIndex).Scan(&exists)
+		accounts, err := selectAccounts(account)
 		if err != nil {
-			log.Println("DB Error:", err)
-			continue
+			slog.Error("Cannot select accounts", "err", err)
+			return exitUsage
+		}
+		health.watch(schedule, accounts)
+		runCycle(ctx, db, clients, accounts)
+
+		select {
+		case <-stopping:
+			slog.Info("Shutdown complete")
+			return exitOK
+		case <-lost:
+			slog.Error("Another instance took over, exiting")
+			return exitError
+		default:
 		}
 
-		if exists == 0 {
-			// New grade entry
-			if !isFirstRun {
-				fmt.Printf("New Grade found: %s - %s\n", g.Module, g.Grade)
-				log.Printf("New Grade found: %s - %s\n", g.Module, g.Grade)
-				log.Printf("New Grade found: %s - %s\n", g.Module, g.Grade)
-				if g.Grade != "#" {
-					notify(g.Module, g.Grade)
-				} else {
-					log.Printf("Skipping notification for placeholder grade '#' for module: %s\n", g.Module)
-				}
-			} else {
-				log.Printf("Silently adding initial grade: %s - %s\n", g.Module, g.Grade)
-			}
-
-			log.Printf("Debug: Hex dump of new module name: %x\n", g.Module)
-			_, err = db.Exec("INSERT INTO grades_v2 (module_name, grade, occurrence_index, status, updated_at) VALUES (?, ?, ?, ?, ?)",
-				g.Module, g.Grade, g.OccurrenceIndex, "new", time.Now().Format(time.RFC3339))
-			if err != nil {
-				log.Println("Insert Error:", err)
-			}
-
-		} else {
-			// Check if grade changed
-			var currentGrade string
-			err = db.QueryRow("SELECT grade FROM grades_v2 WHERE module_name = ? AND occurrence_index = ?", g.Module, g.OccurrenceIndex).Scan(&currentGrade)
-
-			if err == nil && currentGrade != g.Grade {
-				fmt.Printf("Grade updated: %s - %s -> %s\n", g.Module, currentGrade, g.Grade)
-				log.Printf("Grade updated: %s - %s -> %s\n", g.Module, currentGrade, g.Grade)
+		next := schedule.NextJittered(time.Now())
+		timer := time.NewTimer(time.Until(next))
+		storeNextCheck(db, next)
+		// After a reload; the account list is updated by the next cycle
+		reschedule := func() {
+			schedule = loadScheduleOrDefault()
+			health.watch(schedule, accounts)
+			next = schedule.NextJittered(time.Now())
+			timer.Reset(time.Until(next))
+			storeNextCheck(db, next)
+		}
 
-				_, err = db.Exec("UPDATE grades_v2 SET grade = ?, updated_at = ? WHERE module_name = ? AND occurrence_index = ?",
-					g.Grade, time.Now().Format(time.RFC3339), g.Module, g.OccurrenceIndex)
-				if err != nil {
-					log.Println("Update Error:", err)
+	wait:
+		for {
+			select {
+			case <-stopping:
+				timer.Stop()
+				slog.Info("Shutdown complete")
+				return exitOK
+			case <-lost:
+				timer.Stop()
+				slog.Error("Another instance took over, exiting")
+				return exitError
+			case <-sigs.check:
+				timer.Stop()
+				slog.Info("Check requested")
+				break wait
+			case <-checkRequests:
+				timer.Stop()
+				slog.Info("Check requested via API")
+				break wait
+			case <-sigs.reload:
+				slog.Info("Reloading configuration")
+				reloadConfig()
+				reschedule()
+			case <-configChanged:
+				if reloadConfig() {
+					reschedule()
 				}
-
-				notify(g.Module, g.Grade)
+			case <-timer.C:
+				break wait
 			}
 		}
 	}
+}
 
-	if isFirstRun {
-		log.Println("Initial silent sync complete. Notifications will be enabled for future runs.")
+// loadScheduleOrDefault returns the configured schedule, falling back to
+// hourly checks if it is invalid.
+func loadScheduleOrDefault() *plan {
+	schedule, err := loadSchedule(currentConfig())
+	if err != nil {
+		slog.Warn("Invalid schedule, checking every 60 minutes", "err", err)
+		return &plan{base: every(time.Hour)}
 	}
+	return schedule
+}
 
-	// Update last check time
-	_, err = db.Exec(`INSERT INTO system_status (key, value, updated_at) 
-		VALUES ('last_check', ?, ?) 
-		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=excluded.updated_at`,
-		time.Now().Format(time.RFC3339), time.Now().Format(time.RFC3339))
+func storeNextCheck(db Store, next time.Time) {
+	if err := db.SetStatus(context.Background(), "next_check", next.Format(time.RFC3339)); err != nil {
+		slog.Error("Error storing next check time", "err", err)
+	}
+	slog.Info("Next check planned", "at", next.Format("2006-01-02 15:04:05"))
+}
+
+// readVersion returns the version from version.json.
+func readVersion() (string, error) {
+	versionFile, err := os.ReadFile("version.json")
 	if err != nil {
-		log.Println("Error updating last_check:", err)
+		return "", err
 	}
+	var versionConfig VersionConfig
+	if err := json.Unmarshal(versionFile, &versionConfig); err != nil {
+		return "", err
+	}
+	return versionConfig.Version, nil
 }
 
-func performLogin(client *http.Client, username, password string) error {
-	log.Println("Fetching login page...")
-	resp, err := client.Get(loginURL)
+func performLogin(ctx context.Context, client *http.Client, username, password string) error {
+	password, err := resolveSecret(ctx, password)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errConfig, err)
+	}
+
+	slog.Debug("Fetching login page")
+	req, err := http.NewRequestWithContext(ctx, "GET", loginURL, nil)
 	if err != nil {
 		return err
 	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNetwork, err)
+	}
 	defer resp.Body.Close()
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
@@ -381,11 +325,16 @@ func performLogin(client *http.Client, username, password string) error {
 		data.Set(name, val)
 	})
 
-	log.Println("Submitting login credentials...")
-	resp, err = client.PostForm(action, data)
+	slog.Debug("Submitting login credentials")
+	req, err = http.NewRequestWithContext(ctx, "POST", action, strings.NewReader(data.Encode()))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNetwork, err)
+	}
 	defer resp.Body.Close()
 
 	// Verify login success
@@ -398,7 +347,7 @@ func performLogin(client *http.Client, username, password string) error {
 		return fmt.Errorf("login failed: invalid credentials")
 	}
 
-	log.Println("Login successful.")
+	slog.Info("Login successful")
 	return nil
 }
 
@@ -418,12 +367,12 @@ func downloadWithProgress(resp *http.Response) ([]byte, error) {
 				percent := float64(downloaded) / float64(size) * 100
 				// Log every 20%
 				if downloaded%(size/5) < n {
-					log.Printf("Downloading: %.0f%% (%d/%d bytes)\n", percent, downloaded, size)
+					slog.Debug("Downloading", "percent", int(percent), "bytes", downloaded, "size", size)
 				}
 			} else {
 				// If no content length, just log bytes
 				if downloaded%(1024*1024) < n { // Every 1MB
-					log.Printf("Downloaded: %d bytes...\n", downloaded)
+					slog.Debug("Downloading", "bytes", downloaded)
 				}
 			}
 		}
@@ -437,115 +386,8 @@ func downloadWithProgress(resp *http.Response) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func readPdf(path string) (string, error) {
-	f, r, err := pdf.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
-	var buf bytes.Buffer
-	b, err := r.GetPlainText()
-	if err != nil {
-		return "", err
-	}
-	buf.ReadFrom(b)
-	return buf.String(), nil
-}
-
-func extractGrades(text string) []Grade {
-	var grades []Grade
-	lines := strings.Split(text, "\n")
-
-	// Clean lines
-	var cleanLines []string
-	for _, l := range lines {
-		l = strings.TrimSpace(l)
-		if l != "" {
-			cleanLines = append(cleanLines, l)
-		}
-	}
-
-	// Regex for Module ID (e.g., I169)
-	reID := regexp.MustCompile(`^I\d+$`)
-
-	var currentModuleID string
-	var currentModuleName string
-	var currentGradeParts []string
-
-	// Track occurrences of each module to handle retakes
-	moduleOccurrences := make(map[string]int)
-
-	for i := 0; i < len(cleanLines); i++ {
-		line := cleanLines[i]
-
-		if reID.MatchString(line) {
-			// Save previous module if exists
-			if currentModuleID != "" {
-				gradeStr := strings.Join(currentGradeParts, " ")
-				if gradeStr == "" {
-					gradeStr = "?" // Should not happen usually
-				}
-
-				// Calculate occurrence index
-				idx := moduleOccurrences[currentModuleName]
-				moduleOccurrences[currentModuleName]++
-
-				grades = append(grades, Grade{
-					Module:          currentModuleName,
-					Grade:           gradeStr,
-					OccurrenceIndex: idx,
-				})
-			}
-
-			// Start new module
-			currentModuleID = line
-			if i+1 < len(cleanLines) {
-				currentModuleName = normalizeString(cleanLines[i+1])
-				i++ // Skip name line
-			} else {
-				currentModuleName = "Unknown"
-			}
-			currentGradeParts = []string{}
-		} else {
-			// Collecting grade info
-			// Skip CP lines
-			if strings.HasSuffix(line, " CP") || line == "Credits" {
-				continue
-			}
-			// Skip other potential headers if they appear (heuristic)
-			if line == "Note" || line == "Name" || line == "ModulNr" {
-				continue
-			}
-
-			// Stop if we hit the footer
-			if strings.HasPrefix(line, "Diese Notenübersicht ist kein Zeugnis") ||
-				strings.HasPrefix(line, "Der derzeitige Notendurchschnitt") {
-				break
-			}
-
-			// Append to grade
-			if currentModuleID != "" {
-				currentGradeParts = append(currentGradeParts, line)
-			}
-		}
-	}
-
-	// Add last module
-	if currentModuleID != "" {
-		gradeStr := strings.Join(currentGradeParts, " ")
-
-		idx := moduleOccurrences[currentModuleName]
-		moduleOccurrences[currentModuleName]++
-
-		grades = append(grades, Grade{
-			Module:          currentModuleName,
-			Grade:           gradeStr,
-			OccurrenceIndex: idx,
-		})
-	}
-
-	return grades
+func now() string {
+	return time.Now().Format(time.RFC3339)
 }
 
 func normalizeString(s string) string {
@@ -566,169 +408,28 @@ func normalizeString(s string) string {
 	return strings.TrimSpace(s)
 }
 
-func notify(module, grade string) error {
-	msg := fmt.Sprintf("New Grade: %s - %s", module, grade)
-	log.Printf("Preparing notification for: %s\n", msg)
-
-	// Local Notification
-	if path, err := exec.LookPath("notify-send"); err == nil {
-		cmd := exec.Command(path, "GradeChecker", msg)
-		cmd.Run()
-	} else {
-		log.Println("Notification skipped: notify-send not found")
-	}
-
-	// Discord Notification
-	discordEnabled := os.Getenv("DISCORD_ENABLED")
-	log.Printf("DISCORD_ENABLED: %s\n", discordEnabled)
-
-	if discordEnabled == "true" || discordEnabled == "1" || discordEnabled == "yes" {
-		mode := os.Getenv("DISCORD_MODE")
-		log.Printf("DISCORD_MODE: %s\n", mode)
-
-		if mode == "dm" {
-			// Custom Bot Mode
-			token := strings.TrimSpace(os.Getenv("DISCORD_BOT_TOKEN"))
-			userID := strings.TrimSpace(os.Getenv("DISCORD_USER_ID"))
-
-			log.Printf("DM Mode - Token Present: %v, UserID: %s\n", token != "", userID)
-
-			if token != "" && userID != "" {
-				return sendDiscordDM(token, userID, msg)
-			}
-			return fmt.Errorf("DM mode enabled but missing token or user ID")
-		} else {
-			// Webhook Mode
-			webhookURL := os.Getenv("DISCORD_WEBHOOK_URL")
-			log.Printf("Webhook Mode - URL Present: %v\n", webhookURL != "")
-
-			if webhookURL != "" {
-				return sendDiscordNotification(webhookURL, msg)
-			}
-			return fmt.Errorf("Webhook mode enabled but missing URL")
-		}
-	}
-	return nil
-}
-
-func sendDiscordNotification(webhookURL, msg string) error {
-	log.Println("Sending Discord Webhook...")
-	payload := map[string]string{"content": msg}
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
-	}
-
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		log.Println("Failed to send Discord notification:", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	log.Printf("Webhook Response Status: %d\n", resp.StatusCode)
-	if resp.StatusCode != 204 && resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Failed to send Discord notification, status: %d: %s\n", resp.StatusCode, string(body))
-		return fmt.Errorf("status: %d - %s", resp.StatusCode, string(body))
-	}
-	return nil
-}
-
-func sendDiscordDM(token, userID, msg string) error {
-	log.Println("Starting Discord DM process...")
-
-	// 1. Create DM Channel
-	createDMURL := "https://discord.com/api/v10/users/@me/channels"
-	dmPayload := map[string]string{"recipient_id": userID}
-	jsonDMPayload, err := json.Marshal(dmPayload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal DM payload: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", createDMURL, bytes.NewBuffer(jsonDMPayload))
-	if err != nil {
-		log.Println("Failed to create DM request:", err)
-		return err
-	}
-	req.Header.Set("Authorization", "Bot "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	log.Println("Requesting DM Channel creation...")
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("Failed to create DM channel:", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Failed to create DM channel (Status %d): %s\n", resp.StatusCode, string(body))
-		return fmt.Errorf("create DM status: %d - %s", resp.StatusCode, string(body))
-	}
-
-	var dmChannel struct {
-		ID string `json:"id"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&dmChannel); err != nil {
-		log.Println("Failed to parse DM channel response:", err)
-		return err
-	}
-	log.Printf("DM Channel Created: %s\n", dmChannel.ID)
-
-	// 2. Send Message
-	sendMsgURL := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", dmChannel.ID)
-	msgPayload := map[string]string{"content": msg}
-	jsonMsgPayload, err := json.Marshal(msgPayload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message payload: %w", err)
-	}
-
-	reqMsg, err := http.NewRequest("POST", sendMsgURL, bytes.NewBuffer(jsonMsgPayload))
+func checkForUpdates(ctx context.Context, currentVersion string) {
+	slog.Debug("Checking for updates")
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.github.com/repos/Tom60/GradeChecker/releases/latest", nil)
 	if err != nil {
-		log.Println("Failed to create message request:", err)
-		return err
-	}
-	reqMsg.Header.Set("Authorization", "Bot "+token)
-	reqMsg.Header.Set("Content-Type", "application/json")
-
-	log.Println("Sending DM Message...")
-	respMsg, err := client.Do(reqMsg)
-	if err != nil {
-		log.Println("Failed to send DM:", err)
-		return err
-	}
-	defer respMsg.Body.Close()
-
-	if respMsg.StatusCode != 200 {
-		body, _ := io.ReadAll(respMsg.Body)
-		log.Printf("Failed to send DM (Status %d): %s\n", respMsg.StatusCode, string(body))
-		return fmt.Errorf("send DM status: %d - %s", respMsg.StatusCode, string(body))
+		slog.Warn("Failed to check for updates", "err", err)
+		return
 	}
-
-	log.Println("DM Sent Successfully!")
-	return nil
-}
-
-func checkForUpdates(currentVersion string) {
-	log.Println("Checking for updates...")
-	resp, err := http.Get("https://api.github.com/repos/Tom60/GradeChecker/releases/latest")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Println("Failed to check for updates:", err)
+		slog.Warn("Failed to check for updates", "err", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		log.Printf("Failed to check for updates, status: %d\n", resp.StatusCode)
+		slog.Warn("Failed to check for updates", "status", resp.StatusCode)
 		return
 	}
 
 	var release GitHubRelease
 	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		log.Println("Failed to parse release info:", err)
+		slog.Warn("Failed to parse release info", "err", err)
 		return
 	}
 
@@ -739,9 +440,9 @@ func checkForUpdates(currentVersion string) {
 
 	if remoteVer != localVer {
 		msg := fmt.Sprintf("Update Available! New version: %s (Current: %s)\nDownload here: %s", release.TagName, currentVersion, release.HTMLURL)
-		log.Println(msg)
-		notify("System", msg)
+		slog.Info("Update available", "version", release.TagName, "current", currentVersion, "url", release.HTMLURL)
+		notify(ctx, notifySettings(currentConfig().Notify.Discord), "System", msg)
 	} else {
-		log.Println("GradeChecker is up to date.")
+		slog.Info("GradeChecker is up to date")
 	}
 }
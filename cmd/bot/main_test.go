@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
+	"gradechecker/pkg/config"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNormalizeString(t *testing.T) {
@@ -23,3 +30,92 @@ func TestNormalizeString(t *testing.T) {
 		}
 	}
 }
+
+// syncBuffer collects log output written from several goroutines.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestCheckLoopSignals(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("CHECK_INTERVAL", "")
+	t.Cleanup(func() { current.Store(nil) })
+	cfg, err := config.Load("", func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Store(cfg)
+	db, err := openSQLite("grades.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs syncBuffer
+	defer func(orig *slog.Logger) { slog.SetDefault(orig) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	// waitFor waits until msg was logged n times. The checks fail right
+	// away without credentials, so no request leaves the machine.
+	waitFor := func(msg string, n int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); strings.Count(logs.String(), msg) < n; {
+			if time.Now().After(deadline) {
+				t.Fatalf("%q not logged %d times:\n%s", msg, n, logs.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// The signal values do not matter, Windows has no SIGUSR1 and SIGHUP
+	sigs := daemonSignals{
+		stop:   make(chan os.Signal, 1),
+		check:  make(chan os.Signal, 1),
+		reload: make(chan os.Signal, 1),
+	}
+	done := make(chan int)
+	go func() { done <- runLoop(db, "", nil, sigs) }()
+	waitFor("Next check planned", 1)
+
+	sigs.check <- os.Interrupt
+	waitFor("Check requested", 1)
+	waitFor("Next check planned", 2)
+
+	if err := os.WriteFile(".env", []byte("CHECK_INTERVAL=7\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sigs.reload <- os.Interrupt
+	waitFor("Reloading configuration", 1)
+	waitFor("Next check planned", 3)
+	if !strings.Contains(logs.String(), "check.interval") || currentConfig().Check.Interval != config.Duration(7*time.Minute) {
+		t.Errorf("the reload did not apply CHECK_INTERVAL:\n%s", logs.String())
+	}
+	if strings.Count(logs.String(), "Starting check cycle")+strings.Count(logs.String(), "Check failed") == 0 {
+		t.Error("no check ran")
+	}
+
+	sigs.stop <- os.Interrupt
+	select {
+	case code := <-done:
+		if code != exitOK {
+			t.Errorf("exit code %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the loop did not stop")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Durations of logins, downloads and parsing range from milliseconds to a
+// minute on a slow connection.
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics collected while the bot runs. Metrics that are read from the
+// database on every scrape are written by (*api).metrics.
+var (
+	checkCycles = newMetric("gradechecker_check_cycles_total", "counter",
+		`Check cycles per account by result ("success" or the failure class).`, "account", "result")
+	loginAttempts = newMetric("gradechecker_login_attempts_total", "counter",
+		`CIS login attempts by result ("success" or "failure").`, "result")
+	downloadBytes = newMetric("gradechecker_transcript_download_bytes_total", "counter",
+		"Bytes of transcript PDFs downloaded.")
+	downloadDuration = newHistogram("gradechecker_transcript_download_duration_seconds",
+		"Time to download the transcript PDF, including a login if needed.", durationBuckets)
+	parseDuration = newHistogram("gradechecker_parse_duration_seconds",
+		"Time to extract the grades from a source.", durationBuckets, "source")
+	gradeEvents = newMetric("gradechecker_grade_events_total", "counter",
+		"Grade events found by check cycles, by type.", "type")
+	notifications = newMetric("gradechecker_notifications_total", "counter",
+		`Notification deliveries by backend and outcome ("sent" or "failed").`, "backend", "outcome")
+)
+
+var registry = []*metric{checkCycles, loginAttempts, downloadBytes, downloadDuration, parseDuration, gradeEvents, notifications}
+
+// metric is a family of samples in the Prometheus text format, one series
+// per combination of label values.
+type metric struct {
+	name, typ, help string
+	labels          []string
+	// buckets are the upper bounds of a histogram.
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	// Histograms only; counts are per bucket, not cumulative.
+	counts []uint64
+	count  uint64
+}
+
+func newMetric(name, typ, help string, labels ...string) *metric {
+	return &metric{name: name, typ: typ, help: help, labels: labels, series: make(map[string]*series)}
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *metric {
+	m := newMetric(name, "histogram", help, labels...)
+	m.buckets = buckets
+	return m
+}
+
+// get returns the series for the label values, creating it if needed.
+// The caller holds m.mu.
+func (m *metric) get(values []string) *series {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", m.name, len(values), len(m.labels)))
+	}
+	key := strings.Join(values, "\x00")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: values}
+		if m.buckets != nil {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Add adds v to a counter.
+func (m *metric) Add(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(values).value += v
+}
+
+func (m *metric) Inc(values ...string) {
+	m.Add(1, values...)
+}
+
+// Set sets a gauge.
+func (m *metric) Set(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(values).value = v
+}
+
+// Observe adds a sample to a histogram; value holds the sum.
+func (m *metric) Observe(v float64, values ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.get(values)
+	s.value += v
+	s.count++
+	if i, _ := slices.BinarySearch(m.buckets, v); i < len(m.buckets) {
+		s.counts[i]++
+	}
+}
+
+// Since observes the seconds elapsed since start.
+func (m *metric) Since(start time.Time, values ...string) {
+	m.Observe(time.Since(start).Seconds(), values...)
+}
+
+// writeTo writes the metric in the Prometheus text exposition format.
+func (m *metric) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		s := m.series[k]
+		if m.buckets == nil {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, m.labelSet(s.values), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.labelSet(s.values, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.labelSet(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, m.labelSet(s.values), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, m.labelSet(s.values), s.count)
+	}
+}
+
+// labelSet formats the labels of a series, followed by the extra name/value
+// pairs, as {name="value",...}.
+func (m *metric) labelSet(values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range m.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// metrics serves the collected metrics and the gauges read from the database
+// in the Prometheus text format.
+func (a *api) metrics(w http.ResponseWriter, r *http.Request) {
+	gauges, err := databaseGauges(r.Context(), a.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, m := range append(slices.Clone(registry), gauges...) {
+		m.writeTo(bw)
+	}
+	bw.Flush()
+}
+
+// databaseGauges reads the current state from the database, so the values
+// are right from the first scrape after a restart.
+func databaseGauges(ctx context.Context, db Store) ([]*metric, error) {
+	tracked := newMetric("gradechecker_grades_tracked", "gauge",
+		"Grades on the transcript per account (grades marked as removed are not counted).", "account")
+	grades, err := db.Grades(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]float64)
+	for _, g := range grades {
+		if g.Status != eventRemoved {
+			counts[g.Account]++
+		}
+	}
+	for account, n := range counts {
+		tracked.Set(n, account)
+	}
+
+	outbox := newMetric("gradechecker_outbox_depth", "gauge",
+		`Undelivered notifications by state ("pending" is still retried, "failed" gave up).`, "state")
+	pending, failed, err := db.OutboxCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	outbox.Set(float64(pending), "pending")
+	outbox.Set(float64(failed), "failed")
+
+	lastCheck := newMetric("gradechecker_last_successful_check_timestamp_seconds", "gauge",
+		"Unix time of the last check cycle that stored a transcript, per account.", "account")
+	status, err := db.Statuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range status {
+		account, ok := strings.CutPrefix(key, "last_check:")
+		if t, err := time.Parse(time.RFC3339, value); ok && err == nil {
+			lastCheck.Set(float64(t.Unix()), account)
+		}
+	}
+
+	return []*metric{tracked, outbox, lastCheck}, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricFormat(t *testing.T) {
+	h := newHistogram("test_duration_seconds", "Test.", []float64{0.5, 1}, "source")
+	h.Observe(0.5, "pdf")
+	h.Observe(2, "pdf")
+	c := newMetric("test_total", "counter", "Test.", "name")
+	c.Inc(`a"b`)
+
+	var b strings.Builder
+	h.writeTo(&b)
+	c.writeTo(&b)
+	want := `# HELP test_duration_seconds Test.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{source="pdf",le="0.5"} 1
+test_duration_seconds_bucket{source="pdf",le="1"} 1
+test_duration_seconds_bucket{source="pdf",le="+Inf"} 2
+test_duration_seconds_sum{source="pdf"} 2.5
+test_duration_seconds_count{source="pdf"} 2
+# HELP test_total Test.
+# TYPE test_total counter
+test_total{name="a\"b"} 1
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		for _, g := range []storedGrade{
+			{Account: "default", Module: "Mathematik I", Grade: "1,7", Status: eventNew, UpdatedAt: "2026-07-02T10:00:00Z"},
+			{Account: "default", Module: "Mathematik II", Grade: "2,0", Status: eventRemoved, UpdatedAt: "2026-07-02T10:00:00Z"},
+		} {
+			if err := db.InsertGrade(ctx, g); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.SetStatus(ctx, "last_check:default", "2026-07-02T12:00:00+02:00"); err != nil {
+			t.Fatal(err)
+		}
+
+		srv := httptest.NewServer(newAPI(db, "secret", ""))
+		defer srv.Close()
+		req, _ := http.NewRequest("GET", srv.URL+"/metrics", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+
+		for _, line := range []string{
+			`gradechecker_grades_tracked{account="default"} 1`,
+			`gradechecker_outbox_depth{state="pending"} 0`,
+			`gradechecker_last_successful_check_timestamp_seconds{account="default"} 1782986400`,
+			`# TYPE gradechecker_check_cycles_total counter`,
+		} {
+			if !strings.Contains(string(body), line+"\n") {
+				t.Errorf("missing %q in\n%s", line, body)
+			}
+		}
+	})
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Module is an entry of the module catalog. Transcripts do not always name
+// a module the same way: it may be renamed, or the name may come with
+// invisible characters or other Unicode variants. These names are its
+// aliases, and the grades of all of them are stored under the module.
+type Module struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases"`
+	Credits  float64  `json:"credits,omitempty"`
+	Semester int      `json:"semester,omitempty"`
+}
+
+// names returns the name and the aliases of a module.
+func (m Module) names() []string {
+	return append([]string{m.Name}, m.Aliases...)
+}
+
+var (
+	umlauts       = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss", "ẞ", "SS")
+	romanNumerals = map[string]string{"i": "1", "ii": "2", "iii": "3", "iv": "4", "v": "5", "vi": "6", "vii": "7", "viii": "8", "ix": "9", "x": "10"}
+)
+
+// moduleKey reduces a module name to the words that identify it: Unicode
+// compatibility variants are folded, umlauts spelled out, accents and
+// invisible characters dropped, punctuation turned into spaces, the
+// words lower-cased and Roman numerals written as digits. "Mathematik
+// II", "mathematik 2" and "Mathematik II" with a zero-width space have
+// the same key.
+func moduleKey(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(umlauts.Replace(norm.NFC.String(name))) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Cf, r) || !unicode.IsGraphic(r) && !unicode.IsSpace(r):
+			// Accents, zero-width and control characters
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	words := strings.Fields(b.String())
+	for i, w := range words {
+		if n, ok := romanNumerals[w]; ok {
+			words[i] = n
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// minModuleSimilarity is how similar a new name must be to the name of a
+// module for it to be taken as a rename.
+const minModuleSimilarity = 0.8
+
+// moduleSimilarity returns how similar two module keys are, from 0 to 1:
+// one minus the edit distance relative to the longer key. Keys with
+// different numbers are different modules ("Mathematik 1" and
+// "Mathematik 2") and get 0.
+func moduleSimilarity(a, b string) float64 {
+	numbers := func(key string) []string {
+		var n []string
+		for _, w := range strings.Fields(key) {
+			if strings.IndexFunc(w, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+				n = append(n, w)
+			}
+		}
+		return n
+	}
+	if !slices.Equal(numbers(a), numbers(b)) {
+		return 0
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(max(len(ra), len(rb)))
+}
+
+// editDistance is the Levenshtein distance of two strings.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// similarModule returns the module of candidates whose name or alias is
+// most similar to name, if it is similar enough and no other module is as
+// similar.
+func similarModule(candidates []Module, name string) (Module, bool) {
+	key := moduleKey(name)
+	var best Module
+	bestScore, tie := 0.0, false
+	for _, m := range candidates {
+		score := 0.0
+		for _, n := range m.names() {
+			score = max(score, moduleSimilarity(key, moduleKey(n)))
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, tie = m, score, false
+		case score == bestScore:
+			tie = true
+		}
+	}
+	return best, bestScore >= minModuleSimilarity && !tie
+}
+
+// resolveModules maps the module names of a transcript to the catalog and
+// returns the grades with the names of their modules. A name is matched
+// to the module with that name or alias, or else with the same key (see
+// moduleKey). A name still unknown is matched to a similar module of
+// previous, the modules the account had before, if that one is missing
+// from the transcript: the module was renamed. Other names become new
+// modules. Matched names are added as aliases, and the attempts are
+// numbered per module.
+func resolveModules(ctx context.Context, tx Store, grades []Grade, previous []string) ([]Grade, error) {
+	catalog, err := tx.Modules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Module)
+	byKey := make(map[string]Module)
+	for _, m := range catalog {
+		for _, n := range m.names() {
+			byName[n] = m
+			if _, ok := byKey[moduleKey(n)]; !ok {
+				byKey[moduleKey(n)] = m
+			}
+		}
+	}
+
+	var names []string
+	resolved := make(map[string]Module)
+	taken := make(map[int64]bool)
+	for _, g := range grades {
+		if slices.Contains(names, g.Module) {
+			continue
+		}
+		names = append(names, g.Module)
+		m, ok := byName[g.Module]
+		if !ok {
+			m, ok = byKey[moduleKey(g.Module)]
+		}
+		if ok {
+			resolved[g.Module] = m
+			taken[m.ID] = true
+		}
+	}
+
+	var candidates []Module
+	for _, m := range catalog {
+		if slices.Contains(previous, m.Name) && !taken[m.ID] {
+			candidates = append(candidates, m)
+		}
+	}
+	for _, name := range names {
+		if _, ok := resolved[name]; ok {
+			continue
+		}
+		m, ok := similarModule(candidates, name)
+		if ok && !taken[m.ID] {
+			slog.Info("Module renamed on the transcript", "module", m.Name, "name", name)
+		} else if m, err = tx.AddModule(ctx, name); err != nil {
+			return nil, err
+		}
+		resolved[name] = m
+		taken[m.ID] = true
+	}
+
+	for _, name := range names {
+		if m := resolved[name]; !slices.Contains(m.names(), name) {
+			slog.Debug("Recording another name of a module", "module", m.Name, "name", name)
+			if err := tx.AddAlias(ctx, m.ID, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	out := make([]Grade, len(grades))
+	attempts := make(map[int64]int)
+	for i, g := range grades {
+		m := resolved[g.Module]
+		out[i] = Grade{Module: m.Name, Grade: g.Grade, OccurrenceIndex: attempts[m.ID]}
+		attempts[m.ID]++
+	}
+	return out, nil
+}
+
+// duplicateModules groups the modules with the same key, which are one
+// module whose name came in different variants, and lists the pairs of
+// other modules that are similar enough to be a rename. The groups are
+// ordered by the module to keep: one whose name needs no normalizing,
+// else the oldest.
+func duplicateModules(catalog []Module) (groups [][]Module, similar [][2]Module) {
+	byKey := make(map[string]int)
+	for _, m := range catalog {
+		key := moduleKey(m.Name)
+		i, ok := byKey[key]
+		if !ok {
+			byKey[key] = len(groups)
+			groups = append(groups, []Module{m})
+			continue
+		}
+		groups[i] = append(groups[i], m)
+	}
+
+	var dups [][]Module
+	for _, g := range groups {
+		if len(g) > 1 {
+			slices.SortFunc(g, func(a, b Module) int {
+				if ca, cb := normalizeString(a.Name) == a.Name, normalizeString(b.Name) == b.Name; ca != cb {
+					if ca {
+						return -1
+					}
+					return 1
+				}
+				return cmp.Compare(a.ID, b.ID)
+			})
+			dups = append(dups, g)
+		}
+	}
+
+	for i := range groups {
+		for j := i + 1; j < len(groups); j++ {
+			a, b := groups[i][0], groups[j][0]
+			if moduleSimilarity(moduleKey(a.Name), moduleKey(b.Name)) >= minModuleSimilarity {
+				similar = append(similar, [2]Module{a, b})
+			}
+		}
+	}
+	return dups, similar
+}
+
+func cmdModules(args []string) int {
+	fs := newFlagSet("modules")
+	asJSON := fs.Bool("json", false, "list the catalog as JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	sub := "list"
+	if fs.NArg() > 0 {
+		sub = fs.Arg(0)
+	}
+	if sub != "list" && sub != "edit" && sub != "merge" || sub == "list" && fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	db, err := openDB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer db.Close()
+	if sub == "list" {
+		return listModules(db, *asJSON)
+	}
+
+	inst, err := acquireInstance(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	defer inst.Release()
+	if sub == "edit" {
+		return editModule(db, fs.Args()[1:])
+	}
+	return mergeModules(db, fs.Args()[1:])
+}
+
+func listModules(db Store, asJSON bool) int {
+	ctx := context.Background()
+	catalog, err := db.Modules(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Modules []Module `json:"modules"`
+		}{catalog}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		return exitOK
+	}
+	if len(catalog) == 0 {
+		fmt.Fprintln(os.Stderr, "No modules stored yet.")
+		return exitOK
+	}
+
+	grades, err := db.Grades(ctx, "", "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	counts := make(map[int64]int)
+	for _, g := range grades {
+		counts[g.ModuleID]++
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tMODULE\tCREDITS\tSEMESTER\tGRADES\tALIASES")
+	for _, m := range catalog {
+		credits, semester := "", ""
+		if m.Credits != 0 {
+			credits = strconv.FormatFloat(m.Credits, 'f', -1, 64)
+		}
+		if m.Semester != 0 {
+			semester = strconv.Itoa(m.Semester)
+		}
+		aliases := make([]string, len(m.Aliases))
+		for i, a := range m.Aliases {
+			aliases[i] = strconv.Quote(a)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\n", m.ID, m.Name, credits, semester, counts[m.ID], strings.Join(aliases, ", "))
+	}
+	tw.Flush()
+	return exitOK
+}
+
+func editModule(db Store, args []string) int {
+	fs := newFlagSet("modules")
+	name := fs.String("name", "", "rename the module; the previous name becomes an alias")
+	credits := fs.Float64("credits", 0, "credits (CP) of the module, 0 for unknown")
+	semester := fs.Int("semester", 0, "semester of the module in the study plan, 0 for unknown")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if fs.NArg() != 1 || err != nil {
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	m, err := db.Module(ctx, id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "module %d: %v\n", id, err)
+		return exitError
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			m.Name = strings.TrimSpace(*name)
+		case "credits":
+			m.Credits = *credits
+		case "semester":
+			m.Semester = *semester
+		}
+	})
+	if m.Name == "" || m.Credits < 0 || m.Semester < 0 {
+		fmt.Fprintln(os.Stderr, "the name must not be empty, credits and semester not negative")
+		return exitUsage
+	}
+	if err := db.UpdateModule(ctx, m); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	fmt.Printf("Updated module %d %q\n", m.ID, m.Name)
+	return exitOK
+}
+
+func mergeModules(db Store, args []string) int {
+	fs := newFlagSet("modules")
+	dryRun := fs.Bool("dry-run", false, "only list the modules that would be merged")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	ctx := context.Background()
+	catalog, err := db.Modules(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	var groups [][]Module
+	var similar [][2]Module
+	switch fs.NArg() {
+	case 0:
+		groups, similar = duplicateModules(catalog)
+	case 1:
+		fs.Usage()
+		return exitUsage
+	default:
+		var group []Module
+		for _, arg := range fs.Args() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			i := slices.IndexFunc(catalog, func(m Module) bool { return m.ID == id })
+			if err != nil || i < 0 {
+				fmt.Fprintf(os.Stderr, "no module with ID %s\n", arg)
+				return exitUsage
+			}
+			if !slices.ContainsFunc(group, func(m Module) bool { return m.ID == id }) {
+				group = append(group, catalog[i])
+			}
+		}
+		groups = [][]Module{group}
+	}
+
+	failed := false
+	for _, g := range groups {
+		for _, m := range g[1:] {
+			if *dryRun {
+				fmt.Printf("Would merge %d %q into %d %q\n", m.ID, m.Name, g[0].ID, g[0].Name)
+				continue
+			}
+			if err := db.MergeModules(ctx, g[0].ID, m.ID); err != nil {
+				fmt.Fprintf(os.Stderr, "Not merging %d into %d: %v\n", m.ID, g[0].ID, err)
+				// Found duplicates may turn out to be different modules
+				failed = failed || fs.NArg() > 0 || !errors.Is(err, errModuleConflict)
+				continue
+			}
+			fmt.Printf("Merged %d %q into %d %q\n", m.ID, m.Name, g[0].ID, g[0].Name)
+		}
+	}
+	for _, p := range similar {
+		fmt.Printf("Maybe the same module: %d %q and %d %q (merge with \"gradechecker modules merge %d %d\")\n",
+			p[0].ID, p[0].Name, p[1].ID, p[1].Name, p[0].ID, p[1].ID)
+	}
+	if len(groups) == 0 && len(similar) == 0 {
+		fmt.Println("No duplicate modules found.")
+	}
+	if failed {
+		return exitError
+	}
+	return exitOK
+}
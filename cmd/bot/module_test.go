@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestModuleKey(t *testing.T) {
+	for _, names := range [][]string{
+		{"Mathematik II", "mathematik 2", "Mathe\u200bmatik II", "Mathematik\u00a0II", "MATHEMATIK  II "},
+		{"Übung zur Programmierung", "Uebung zur Programmierung", "U\u0308bung zur Programmierung"},
+		{"Recht & Steuern (Teil 1)", "Recht - Steuern, Teil I"},
+		{"Café-Kultur", "Cafe Kultur", "ｃａｆｅ kultur"},
+	} {
+		want := moduleKey(names[0])
+		for _, n := range names[1:] {
+			if got := moduleKey(n); got != want {
+				t.Errorf("moduleKey(%q) = %q, want %q like %q", n, got, want, names[0])
+			}
+		}
+	}
+	if a, b := moduleKey("Mathematik I"), moduleKey("Mathematik II"); a == b {
+		t.Errorf("Mathematik I and II have the same key %q", a)
+	}
+}
+
+func TestModuleSimilarity(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		same bool
+	}{
+		{"Programmieren", "Programmierung", true},
+		{"Einführung in die Informatik", "Einfuehrung in die Informatik", true},
+		{"Mathematik I", "Mathematik II", false},
+		{"Statistik", "Statik", false},
+		{"Wirtschaftsinformatik", "Wirtschaftsmathematik", false},
+	} {
+		score := moduleSimilarity(moduleKey(tc.a), moduleKey(tc.b))
+		if same := score >= minModuleSimilarity; same != tc.same {
+			t.Errorf("similarity of %q and %q = %.2f, want same module %v", tc.a, tc.b, score, tc.same)
+		}
+	}
+}
+
+func TestResolveModules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		for _, name := range []string{"Mathematik II", "Programmieren", "Grundlagen der BWL", "Recht"} {
+			if err := db.InsertGrade(ctx, storedGrade{Account: "default", Module: name, Grade: "2,0", Status: eventNew}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		previous := []string{"Mathematik II", "Programmieren", "Grundlagen der BWL"}
+
+		transcript := []Grade{
+			{Module: "Mathe\u200bmatik II", Grade: "2,0"},
+			{Module: "Programmierung", Grade: "2,0"},
+			{Module: "Grundlagen der BWL", Grade: "2,0"},
+			// Similar to a module that is still on the transcript
+			{Module: "Grundlagen der VWL", Grade: "1,0"},
+			// Similar to a module of another account
+			{Module: "Rechte", Grade: "1,0"},
+			{Module: "Programmierung", Grade: "1,7", OccurrenceIndex: 1},
+		}
+		want := []Grade{
+			{Module: "Mathematik II", Grade: "2,0"},
+			{Module: "Programmieren", Grade: "2,0"},
+			{Module: "Grundlagen der BWL", Grade: "2,0"},
+			{Module: "Grundlagen der VWL", Grade: "1,0"},
+			{Module: "Rechte", Grade: "1,0"},
+			{Module: "Programmieren", Grade: "1,7", OccurrenceIndex: 1},
+		}
+		for range 2 {
+			got, err := resolveModules(ctx, db, transcript, previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("resolved %+v, want %+v", got, want)
+			}
+		}
+
+		catalog, err := db.Modules(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aliases := make(map[string][]string)
+		for _, m := range catalog {
+			aliases[m.Name] = m.Aliases
+		}
+		if len(catalog) != 6 || !slices.Equal(aliases["Programmieren"], []string{"Programmierung"}) ||
+			!slices.Equal(aliases["Mathematik II"], []string{"Mathe\u200bmatik II"}) || len(aliases["Recht"]) != 0 {
+			t.Errorf("catalog = %+v", catalog)
+		}
+		if grades, err := db.Grades(ctx, "default", "programmierung"); err != nil || len(grades) != 1 {
+			t.Errorf("grades found by alias = %+v, %v", grades, err)
+		}
+	})
+}
+
+func TestUpdateModule(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		if err := db.InsertGrade(ctx, storedGrade{Account: "default", Module: "Programmieren", Grade: "2,0", Status: eventNew}); err != nil {
+			t.Fatal(err)
+		}
+		grades, _ := db.Grades(ctx, "", "")
+		m, err := db.Module(ctx, grades[0].ModuleID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Name, m.Credits, m.Semester = "Programmierung", 7.5, 2
+		if err := db.UpdateModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		m.Aliases = []string{"Programmieren"}
+		if got, err := db.Module(ctx, m.ID); err != nil || got.Name != m.Name || got.Credits != 7.5 || got.Semester != 2 ||
+			!slices.Equal(got.Aliases, m.Aliases) {
+			t.Errorf("Module = %+v, %v, want %+v", got, err, m)
+		}
+		if grades, _ := db.Grades(ctx, "", ""); grades[0].Module != "Programmierung" {
+			t.Errorf("grade of module %q", grades[0].Module)
+		}
+		if err := db.InsertGrade(ctx, storedGrade{Account: "bob", Module: "Programmieren", Grade: "1,0", Status: eventNew}); err != nil {
+			t.Fatal(err)
+		}
+		if grades, _ := db.Grades(ctx, "bob", ""); len(grades) != 1 || grades[0].ModuleID != m.ID {
+			t.Errorf("grade stored under the previous name = %+v", grades)
+		}
+
+		// Renaming back turns the alias into the name again
+		m.Name, m.Credits = "Programmieren", 0
+		if err := db.UpdateModule(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := db.Module(ctx, m.ID); got.Credits != 0 || !slices.Equal(got.Aliases, []string{"Programmierung"}) {
+			t.Errorf("Module = %+v", got)
+		}
+		other, err := db.AddModule(ctx, "Analysis")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other.Name = "Programmierung"
+		if err := db.UpdateModule(ctx, other); err == nil {
+			t.Error("renamed a module to an alias of another one")
+		}
+		if _, err := db.Module(ctx, 1000); !errors.Is(err, errNotFound) {
+			t.Errorf("missing module: %v", err)
+		}
+	})
+}
+
+func TestMergeModules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		// A bot before the module catalog stored a variant of the name as
+		// another module, and marked the grade of the first as removed
+		for _, g := range []storedGrade{
+			{Account: "default", Module: "Mathematik I", Grade: "#", Status: eventRemoved, UpdatedAt: "2026-07-01T10:00:00Z"},
+			{Account: "default", Module: "Mathematik I", Grade: "2,0", OccurrenceIndex: 1, Status: eventNew, UpdatedAt: "2026-07-01T10:00:00Z"},
+			{Account: "default", Module: "Mathe\u200bmatik I", Grade: "1,7", Status: eventNew, UpdatedAt: "2026-07-02T10:00:00Z"},
+			{Account: "bob", Module: "Mathe\u200bmatik I", Grade: "3,0", Status: eventNew, UpdatedAt: "2026-07-02T10:00:00Z"},
+			{Account: "default", Module: "Physik", Grade: "1,0", Status: eventNew},
+			{Account: "default", Module: "Physik\u00a0", Grade: "1,3", Status: eventNew},
+		} {
+			if err := db.InsertGrade(ctx, g); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, e := range []GradeEvent{
+			{Account: "default", Type: eventNew, Module: "Mathematik I", Grade: "#", Time: "2026-07-01T10:00:00Z"},
+			{Account: "default", Type: eventNew, Module: "Mathe\u200bmatik I", Grade: "1,7", Time: "2026-07-02T10:00:00Z"},
+		} {
+			if err := db.AddEvent(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		catalog, err := db.Modules(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups, _ := duplicateModules(catalog)
+		if len(groups) != 2 || groups[0][0].Name != "Mathematik I" || groups[1][0].Name != "Physik" {
+			t.Fatalf("duplicates = %+v", groups)
+		}
+
+		math := groups[0]
+		if err := db.MergeModules(ctx, math[0].ID, math[1].ID); err != nil {
+			t.Fatal(err)
+		}
+		grades, err := db.Grades(ctx, "", "Mathematik I")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(grades) != 3 || grades[1].Grade != "1,7" || grades[1].Status != eventNew || grades[2].OccurrenceIndex != 1 || grades[0].Account != "bob" {
+			t.Errorf("merged grades = %+v", grades)
+		}
+		if events, err := db.Events(ctx, "default", "Mathematik I", 0); err != nil || len(events) != 2 {
+			t.Errorf("merged history = %+v, %v", events, err)
+		}
+		if m, err := db.Module(ctx, math[0].ID); err != nil || !slices.Equal(m.Aliases, []string{"Mathe\u200bmatik I"}) {
+			t.Errorf("merged module = %+v, %v", m, err)
+		}
+		if _, err := db.Module(ctx, math[1].ID); !errors.Is(err, errNotFound) {
+			t.Errorf("the merged module is still there: %v", err)
+		}
+
+		// Both physics grades are on the transcript
+		physics := groups[1]
+		if err := db.MergeModules(ctx, physics[0].ID, physics[1].ID); !errors.Is(err, errModuleConflict) {
+			t.Errorf("merging current grades: %v, want errModuleConflict", err)
+		}
+		if _, err := db.Module(ctx, physics[1].ID); err != nil {
+			t.Errorf("a failed merge deleted the module: %v", err)
+		}
+	})
+}
+
+func TestImportFollowsRenamedModules(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		date := func(s string) time.Time {
+			d, _ := time.Parse(time.DateOnly, s)
+			return d.Add(12 * time.Hour)
+		}
+		snaps := []snapshot{
+			{"a.pdf", date("2025-10-01"), []Grade{{Module: "Programmieren", Grade: "#"}}},
+			{"b.pdf", date("2026-01-15"), []Grade{{Module: "Programmierung", Grade: "2,3"}}},
+		}
+		if _, err := importHistory(ctx, db, Account{Name: defaultAccount}, snaps); err != nil {
+			t.Fatal(err)
+		}
+		events, err := db.AccountEvents(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[1].Type != eventChanged || events[1].Module != "Programmieren" {
+			t.Errorf("events = %+v", events)
+		}
+	})
+}
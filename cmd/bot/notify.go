@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gradechecker/pkg/config"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// NotifySettings holds the notification routing of one account.
+type NotifySettings struct {
+	DiscordEnabled    bool
+	DiscordMode       string
+	DiscordBotToken   string
+	DiscordUserID     string
+	DiscordWebhookURL string
+}
+
+// notifySettings converts the configured Discord settings of an account.
+func notifySettings(d config.Discord) NotifySettings {
+	return NotifySettings{
+		DiscordEnabled:    d.IsEnabled(),
+		DiscordMode:       d.Mode,
+		DiscordBotToken:   d.BotToken,
+		DiscordUserID:     d.UserID,
+		DiscordWebhookURL: d.WebhookURL,
+	}
+}
+
+func notify(ctx context.Context, ns NotifySettings, module, grade string) error {
+	return notifyMessage(ctx, ns, gradeMessage(module, grade))
+}
+
+func gradeMessage(module, grade string) string {
+	return fmt.Sprintf("New Grade: %s - %s", module, grade)
+}
+
+// notifyMessage sends a free-form message through all enabled backends.
+func notifyMessage(ctx context.Context, ns NotifySettings, msg string) error {
+	var errs []error
+	for _, n := range notifiers(ns) {
+		// The message may hold grades, which stay out of the log
+		slog.Info("Sending notification", "backend", n.Name())
+		if err := n.Send(ctx, msg); err != nil {
+			slog.Warn("Notification failed", "backend", n.Name(), "err", err)
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Notifier is a notification backend.
+type Notifier interface {
+	Name() string
+	Send(ctx context.Context, msg string) error
+}
+
+// dryRunner is implemented by backends that can verify their configuration
+// without delivering a message.
+type dryRunner interface {
+	DryRun(ctx context.Context) error
+}
+
+// notifiers returns the backends enabled by the settings.
+func notifiers(ns NotifySettings) []Notifier {
+	var out []Notifier
+
+	// Local Notification
+	if path, err := exec.LookPath("notify-send"); err == nil {
+		out = append(out, desktopNotifier{path})
+	} else {
+		slog.Debug("Desktop notification skipped: notify-send not found")
+	}
+
+	// Discord Notification
+	if ns.DiscordEnabled {
+		if ns.DiscordMode == "dm" {
+			out = append(out, discordDMNotifier{ns.DiscordBotToken, ns.DiscordUserID})
+		} else {
+			out = append(out, discordWebhookNotifier{ns.DiscordWebhookURL})
+		}
+	}
+	return out
+}
+
+// backendNames lists every notification backend, enabled or not.
+var backendNames = []string{"desktop", "discord-webhook", "discord-dm"}
+
+// notifierByName returns a backend configured from the settings, whether
+// or not it is enabled.
+func notifierByName(ns NotifySettings, name string) (Notifier, error) {
+	switch name {
+	case "desktop":
+		path, err := exec.LookPath("notify-send")
+		if err != nil {
+			return nil, fmt.Errorf("desktop notifications need notify-send: %w", err)
+		}
+		return desktopNotifier{path}, nil
+	case "discord-webhook":
+		return discordWebhookNotifier{ns.DiscordWebhookURL}, nil
+	case "discord-dm":
+		return discordDMNotifier{ns.DiscordBotToken, ns.DiscordUserID}, nil
+	}
+	return nil, fmt.Errorf("unknown notification backend %q (expected one of %s)", name, strings.Join(backendNames, ", "))
+}
+
+type desktopNotifier struct {
+	path string
+}
+
+func (desktopNotifier) Name() string { return "desktop" }
+
+func (n desktopNotifier) Send(ctx context.Context, msg string) error {
+	return exec.CommandContext(ctx, n.path, "GradeChecker", msg).Run()
+}
+
+func (desktopNotifier) DryRun(context.Context) error {
+	if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" && os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return errors.New("no desktop session found, notify-send will not show anything")
+	}
+	return nil
+}
+
+type discordWebhookNotifier struct {
+	url string
+}
+
+func (discordWebhookNotifier) Name() string { return "discord-webhook" }
+
+func (n discordWebhookNotifier) Send(ctx context.Context, msg string) error {
+	url, err := n.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return sendDiscordNotification(ctx, url, msg)
+}
+
+// DryRun fetches the webhook, which Discord answers without posting anything.
+func (n discordWebhookNotifier) DryRun(ctx context.Context) error {
+	url, err := n.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return discordGet(ctx, url, "")
+}
+
+func (n discordWebhookNotifier) resolve(ctx context.Context) (string, error) {
+	if n.url == "" {
+		return "", fmt.Errorf("Webhook mode enabled but missing URL")
+	}
+	return resolveSecret(ctx, n.url)
+}
+
+type discordDMNotifier struct {
+	token, userID string
+}
+
+func (discordDMNotifier) Name() string { return "discord-dm" }
+
+func (n discordDMNotifier) Send(ctx context.Context, msg string) error {
+	token, err := n.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return sendDiscordDM(ctx, token, n.userID, msg)
+}
+
+// DryRun checks that the bot token is valid and the user can be looked up.
+func (n discordDMNotifier) DryRun(ctx context.Context) error {
+	token, err := n.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if err := discordGet(ctx, "https://discord.com/api/v10/users/@me", token); err != nil {
+		return fmt.Errorf("bot token: %w", err)
+	}
+	if err := discordGet(ctx, "https://discord.com/api/v10/users/"+n.userID, token); err != nil {
+		return fmt.Errorf("user ID: %w", err)
+	}
+	return nil
+}
+
+func (n discordDMNotifier) resolve(ctx context.Context) (string, error) {
+	if n.token == "" || n.userID == "" {
+		return "", fmt.Errorf("DM mode enabled but missing token or user ID")
+	}
+	return resolveSecret(ctx, n.token)
+}
+
+// discordGet requests a Discord API resource and fails unless it exists.
+func discordGet(ctx context.Context, target, token string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bot "+token)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status: %d - %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func sendDiscordNotification(ctx context.Context, webhookURL, msg string) error {
+	slog.Debug("Sending Discord webhook")
+	payload := map[string]string{"content": msg}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Warn("Failed to send Discord notification", "err", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	slog.Debug("Discord webhook responded", "status", resp.StatusCode)
+	if resp.StatusCode != 204 && resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		slog.Warn("Failed to send Discord notification", "status", resp.StatusCode, "body", string(body))
+		return fmt.Errorf("status: %d - %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func sendDiscordDM(ctx context.Context, token, userID, msg string) error {
+	slog.Debug("Sending Discord DM")
+
+	// 1. Create DM Channel
+	createDMURL := "https://discord.com/api/v10/users/@me/channels"
+	dmPayload := map[string]string{"recipient_id": userID}
+	jsonDMPayload, err := json.Marshal(dmPayload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal DM payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", createDMURL, bytes.NewBuffer(jsonDMPayload))
+	if err != nil {
+		slog.Warn("Failed to create DM request", "err", err)
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	slog.Debug("Requesting DM channel")
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Warn("Failed to create DM channel", "err", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		slog.Warn("Failed to create DM channel", "status", resp.StatusCode, "body", string(body))
+		return fmt.Errorf("create DM status: %d - %s", resp.StatusCode, string(body))
+	}
+
+	var dmChannel struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&dmChannel); err != nil {
+		slog.Warn("Failed to parse DM channel response", "err", err)
+		return err
+	}
+	slog.Debug("DM channel created", "channel", dmChannel.ID)
+
+	// 2. Send Message
+	sendMsgURL := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", dmChannel.ID)
+	msgPayload := map[string]string{"content": msg}
+	jsonMsgPayload, err := json.Marshal(msgPayload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message payload: %w", err)
+	}
+
+	reqMsg, err := http.NewRequestWithContext(ctx, "POST", sendMsgURL, bytes.NewBuffer(jsonMsgPayload))
+	if err != nil {
+		slog.Warn("Failed to create message request", "err", err)
+		return err
+	}
+	reqMsg.Header.Set("Authorization", "Bot "+token)
+	reqMsg.Header.Set("Content-Type", "application/json")
+
+	slog.Debug("Sending DM message")
+	respMsg, err := client.Do(reqMsg)
+	if err != nil {
+		slog.Warn("Failed to send DM", "err", err)
+		return err
+	}
+	defer respMsg.Body.Close()
+
+	if respMsg.StatusCode != 200 {
+		body, _ := io.ReadAll(respMsg.Body)
+		slog.Warn("Failed to send DM", "status", respMsg.StatusCode, "body", string(body))
+		return fmt.Errorf("send DM status: %d - %s", respMsg.StatusCode, string(body))
+	}
+
+	slog.Info("Discord DM sent")
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// maxOutboxAttempts is how often a notification is tried before it is
+	// given up.
+	maxOutboxAttempts = 10
+	// outboxRetention is how long delivered notifications are kept.
+	outboxRetention = 30 * 24 * time.Hour
+)
+
+// enqueueNotification records msg in the outbox, once for every backend
+// enabled for the account. Written in the same transaction as the change it
+// announces, the message is delivered by dispatchOutbox after the commit
+// (at least once) or not at all if the transaction is rolled back.
+func enqueueNotification(ctx context.Context, tx Store, acc Account, msg string) error {
+	for _, n := range notifiers(acc.Notify) {
+		if err := tx.Enqueue(ctx, acc.Name, n.Name(), msg); err != nil {
+			return fmt.Errorf("queueing notification: %w", err)
+		}
+	}
+	return nil
+}
+
+// outboxNotifier resolves the backend of a queued notification with the
+// current settings of its account.
+var outboxNotifier = func(account, backend string) (Notifier, error) {
+	ns := notifySettings(currentConfig().Notify.Discord)
+	if accounts, err := selectAccounts(account); err == nil {
+		ns = accounts[0].Notify
+	}
+	return notifierByName(ns, backend)
+}
+
+// dispatchOutbox sends all queued notifications that are due. Failed
+// deliveries are retried with exponential backoff on later calls. The
+// messages hold grades, so they are neither logged nor published on the
+// event bus; the outbox ID identifies them.
+func dispatchOutbox(ctx context.Context, db Store) {
+	due, err := db.DueNotifications(ctx)
+	if err != nil {
+		slog.Error("Error reading notification outbox", "err", err)
+		return
+	}
+
+	for _, e := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		n, err := outboxNotifier(e.Account, e.Backend)
+		if err == nil {
+			slog.Info("Sending notification", "id", e.ID, "account", e.Account, "backend", e.Backend)
+			err = n.Send(ctx, e.Message)
+		}
+
+		result := map[string]any{"id": e.ID, "account": e.Account, "backend": e.Backend, "attempts": e.Attempts + 1}
+		if err == nil {
+			notifications.Inc(e.Backend, "sent")
+			bus.Publish(busNotificationSent, result)
+			if err := db.MarkSent(ctx, e.ID); err != nil {
+				slog.Error("Error updating notification outbox", "err", err)
+			}
+			continue
+		}
+
+		slog.Warn("Notification failed", "id", e.ID, "account", e.Account, "backend", e.Backend, "attempt", e.Attempts+1, "err", err)
+		result["error"] = err.Error()
+		notifications.Inc(e.Backend, "failed")
+		bus.Publish(busNotificationFailed, result)
+		if e.Attempts+1 >= maxOutboxAttempts {
+			slog.Error("Giving up on notification", "id", e.ID, "account", e.Account, "backend", e.Backend, "attempts", e.Attempts+1)
+		}
+		// Retry after 1, 2, 4, ... minutes, at most an hour
+		backoff := min(time.Minute<<e.Attempts, time.Hour)
+		if err := db.MarkFailed(ctx, e.ID, err.Error(), time.Now().Add(backoff)); err != nil {
+			slog.Error("Error updating notification outbox", "err", err)
+		}
+	}
+
+	if err := db.PurgeOutbox(ctx, time.Now().Add(-outboxRetention)); err != nil {
+		slog.Error("Error cleaning notification outbox", "err", err)
+	}
+}
+
+// utcNow is the format of outbox.next_attempt_at, which is compared as text.
+func utcNow() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeNotifier struct {
+	sent *[]string
+	err  error
+}
+
+func (fakeNotifier) Name() string { return "fake" }
+
+func (n fakeNotifier) Send(_ context.Context, msg string) error {
+	if n.err != nil {
+		return n.err
+	}
+	*n.sent = append(*n.sent, msg)
+	return nil
+}
+
+func TestOutboxDeliversCommittedNotifications(t *testing.T) {
+	ctx := context.Background()
+	forEachStore(t, func(t *testing.T, db Store) {
+		var sent []string
+		var sendErr error
+		defer func(orig func(string, string) (Notifier, error)) { outboxNotifier = orig }(outboxNotifier)
+		outboxNotifier = func(string, string) (Notifier, error) {
+			return fakeNotifier{&sent, sendErr}, nil
+		}
+
+		// Queue entries are added directly as the backends found by
+		// enqueueNotification depend on the machine.
+		errRollback := errors.New("rollback")
+		enqueue := func(msg string, commit bool) {
+			err := db.Tx(ctx, func(tx Store) error {
+				if err := tx.Enqueue(ctx, "default", "fake", msg); err != nil {
+					return err
+				}
+				if !commit {
+					return errRollback
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errRollback) {
+				t.Fatal(err)
+			}
+		}
+
+		_, events, cancel := bus.Subscribe(0)
+		defer cancel()
+
+		enqueue("rolled back", false)
+		enqueue("committed", true)
+		dispatchOutbox(ctx, db)
+		if len(sent) != 1 || sent[0] != "committed" {
+			t.Fatalf("sent %q, want only the committed message", sent)
+		}
+
+		// Delivered messages are not sent again
+		dispatchOutbox(ctx, db)
+		if len(sent) != 1 {
+			t.Fatalf("sent %q after a second dispatch", sent)
+		}
+
+		// A failed delivery stays queued for a retry
+		sendErr = errors.New("offline")
+		enqueue("retry me", true)
+		dispatchOutbox(ctx, db)
+		var attempts int
+		var lastError string
+		if err := db.(*sqlStore).queryRow(ctx, "SELECT attempts, last_error FROM outbox WHERE message = 'retry me' AND sent_at IS NULL").Scan(&attempts, &lastError); err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 1 || lastError != "offline" {
+			t.Errorf("got attempts=%d last_error=%q, want 1 and %q", attempts, lastError, "offline")
+		}
+
+		// The messages hold grades and stay out of the event stream
+		for published := 0; published < 2; {
+			e := <-events
+			if e.Type != busNotificationSent && e.Type != busNotificationFailed {
+				continue
+			}
+			published++
+			if strings.Contains(string(e.Data), "committed") || strings.Contains(string(e.Data), "retry me") {
+				t.Errorf("%s event with the message: %s", e.Type, e.Data)
+			}
+		}
+	})
+}
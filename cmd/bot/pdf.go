@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// reID matches a module ID (e.g., I169)
+var reID = regexp.MustCompile(`^I\d+$`)
+
+// recoverPdf turns a panic of the pdf package, which it raises on malformed
+// or truncated files, into an error.
+func recoverPdf(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("malformed PDF: %v", r)
+	}
+}
+
+// openPdf opens a transcript, which may be encrypted at rest.
+func openPdf(path string) (*pdf.Reader, error) {
+	data, err := readPrivateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+func readPdf(path string) (_ string, err error) {
+	defer recoverPdf(&err)
+
+	r, err := openPdf(path)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	b, err := r.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	buf.ReadFrom(b)
+	return buf.String(), nil
+}
+
+func extractGrades(text string) []Grade {
+	var grades []Grade
+	lines := strings.Split(text, "\n")
+
+	// Clean lines
+	var cleanLines []string
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l != "" {
+			cleanLines = append(cleanLines, l)
+		}
+	}
+
+	var currentModuleID string
+	var currentModuleName string
+	var currentGradeParts []string
+
+	// Track occurrences of each module to handle retakes
+	moduleOccurrences := make(map[string]int)
+
+	for i := 0; i < len(cleanLines); i++ {
+		line := cleanLines[i]
+
+		if reID.MatchString(line) {
+			// Save previous module if exists
+			if currentModuleID != "" {
+				gradeStr := strings.Join(currentGradeParts, " ")
+				if gradeStr == "" {
+					gradeStr = "?" // Should not happen usually
+				}
+
+				// Calculate occurrence index
+				idx := moduleOccurrences[currentModuleName]
+				moduleOccurrences[currentModuleName]++
+
+				grades = append(grades, Grade{
+					Module:          currentModuleName,
+					Grade:           gradeStr,
+					OccurrenceIndex: idx,
+				})
+			}
+
+			// Start new module
+			currentModuleID = line
+			currentModuleName = ""
+			if i+1 < len(cleanLines) {
+				currentModuleName = normalizeString(cleanLines[i+1])
+				i++ // Skip name line
+			}
+			if currentModuleName == "" {
+				currentModuleName = "Unknown"
+			}
+			currentGradeParts = []string{}
+		} else {
+			// Collecting grade info
+			// Skip CP lines
+			if strings.HasSuffix(line, " CP") || line == "Credits" {
+				continue
+			}
+			// Skip other potential headers if they appear (heuristic)
+			if line == "Note" || line == "Name" || line == "ModulNr" {
+				continue
+			}
+
+			// Stop if we hit the footer
+			if strings.HasPrefix(line, "Diese Notenübersicht ist kein Zeugnis") ||
+				strings.HasPrefix(line, "Der derzeitige Notendurchschnitt") {
+				break
+			}
+
+			// Append to grade
+			if currentModuleID != "" {
+				currentGradeParts = append(currentGradeParts, line)
+			}
+		}
+	}
+
+	// Add last module
+	if currentModuleID != "" {
+		gradeStr := strings.Join(currentGradeParts, " ")
+
+		idx := moduleOccurrences[currentModuleName]
+		moduleOccurrences[currentModuleName]++
+
+		grades = append(grades, Grade{
+			Module:          currentModuleName,
+			Grade:           gradeStr,
+			OccurrenceIndex: idx,
+		})
+	}
+
+	return grades
+}
+
+// pdfTimeout bounds PDF parsing. The pdf package loops forever on some
+// malformed content streams (e.g. an unterminated array); such a parser
+// cannot be stopped and is abandoned so the check cycle can continue.
+var pdfTimeout = 30 * time.Second
+
+// parsePdf extracts the grades of a transcript PDF using the layout-aware
+// parser, falling back to the plain text parser if no grade table is found.
+func parsePdf(path, label string) ([]Grade, error) {
+	type result struct {
+		grades []Grade
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		grades, err := parsePdfLayoutOrText(path, label)
+		done <- result{grades, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.grades, r.err
+	case <-time.After(pdfTimeout):
+		return nil, fmt.Errorf("parsing %s timed out after %v", path, pdfTimeout)
+	}
+}
+
+func parsePdfLayoutOrText(path, label string) ([]Grade, error) {
+	pages, err := readPdfLayout(path)
+	if err == nil {
+		var grades []Grade
+		if grades, err = extractGradesLayout(pages); err == nil {
+			return grades, nil
+		}
+	}
+	slog.Warn(label+"Layout extraction failed, falling back to plain text", "err", err)
+
+	content, err := readPdf(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	return extractGrades(content), nil
+}
+
+// Layout-aware extraction.
+//
+// Instead of relying on the order of GetPlainText, the transcript is rebuilt
+// from the positioned glyphs of every page: glyphs are grouped into lines by
+// their baseline, the table header (ModulNr, Name, CP, Note) defines the
+// column positions, and every glyph is assigned to a column by its X
+// coordinate. A line with a module ID starts a new row, lines without one
+// continue the current row, so wrapped module names and grades stay intact.
+
+const (
+	// lineTolerance is the baseline difference, relative to the font size,
+	// up to which glyphs belong to the same line.
+	lineTolerance = 0.4
+	// wordGap is the horizontal gap, relative to the font size, that
+	// separates two words.
+	wordGap = 0.15
+	// cellGap is the horizontal gap, relative to the font size, that
+	// separates two header cells.
+	cellGap = 1.0
+	// columnMargin is how far, relative to the font size, a value may start
+	// left of its column header (centred or right-aligned values).
+	columnMargin = 2.0
+	// rowGap is the maximum vertical distance, relative to the font size,
+	// between two lines of the same table row.
+	rowGap = 2.5
+)
+
+var errNoTable = errors.New("no grade table header found")
+
+// textLine is a set of glyphs sharing a baseline.
+type textLine struct {
+	Y      float64
+	Size   float64
+	Glyphs []pdf.Text
+}
+
+// column is a table column as defined by its header.
+type column struct {
+	Kind  string // "id", "name", "cp" or "grade"
+	Start float64
+}
+
+// readPdfLayout reads the positioned text of every page of a PDF.
+func readPdfLayout(path string) (_ [][]textLine, err error) {
+	defer recoverPdf(&err)
+
+	r, err := openPdf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages [][]textLine
+	for i := 1; i <= r.NumPage(); i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		pages = append(pages, groupLines(p.Content().Text))
+	}
+	return pages, nil
+}
+
+// groupLines sorts glyphs top to bottom and groups them into lines.
+func groupLines(texts []pdf.Text) []textLine {
+	glyphs := make([]pdf.Text, 0, len(texts))
+	for _, t := range texts {
+		if t.S != "" {
+			glyphs = append(glyphs, t)
+		}
+	}
+	sort.SliceStable(glyphs, func(i, j int) bool {
+		return glyphs[i].Y > glyphs[j].Y
+	})
+
+	var lines []textLine
+	for _, g := range glyphs {
+		if n := len(lines); n > 0 && math.Abs(lines[n-1].Y-g.Y) <= lineTolerance*glyphSize(g) {
+			lines[n-1].Glyphs = append(lines[n-1].Glyphs, g)
+			lines[n-1].Size = math.Max(lines[n-1].Size, glyphSize(g))
+			continue
+		}
+		lines = append(lines, textLine{Y: g.Y, Size: glyphSize(g), Glyphs: []pdf.Text{g}})
+	}
+	for i := range lines {
+		sort.SliceStable(lines[i].Glyphs, func(a, b int) bool {
+			return lines[i].Glyphs[a].X < lines[i].Glyphs[b].X
+		})
+	}
+	return lines
+}
+
+func glyphSize(g pdf.Text) float64 {
+	if g.FontSize > 0 {
+		return g.FontSize
+	}
+	return 10
+}
+
+// glyphEnd returns the right edge of a glyph, estimating it for fonts
+// without width information.
+func glyphEnd(g pdf.Text) float64 {
+	if g.W > 0 {
+		return g.X + g.W
+	}
+	return g.X + 0.5*glyphSize(g)*float64(len([]rune(g.S)))
+}
+
+// joinGlyphs turns X-sorted glyphs into text, inserting spaces at word gaps.
+func joinGlyphs(glyphs []pdf.Text) string {
+	var b strings.Builder
+	for i, g := range glyphs {
+		if i > 0 && g.X-glyphEnd(glyphs[i-1]) > wordGap*glyphSize(g) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(g.S)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// textCell is a run of text separated from its neighbours by a column-sized gap.
+type textCell struct {
+	X    float64
+	Text string
+}
+
+// cells splits a line into cells.
+func (l textLine) cells() []textCell {
+	var out []textCell
+	start := 0
+	for i := 1; i <= len(l.Glyphs); i++ {
+		if i < len(l.Glyphs) && l.Glyphs[i].X-glyphEnd(l.Glyphs[i-1]) <= cellGap*glyphSize(l.Glyphs[i]) {
+			continue
+		}
+		if text := joinGlyphs(l.Glyphs[start:i]); text != "" {
+			out = append(out, textCell{X: l.Glyphs[start].X, Text: text})
+		}
+		start = i
+	}
+	return out
+}
+
+// headerColumns returns the table columns if the line is the table header.
+func headerColumns(l textLine) []column {
+	var cols []column
+	kinds := map[string]bool{}
+	for _, c := range l.cells() {
+		var kind string
+		switch strings.ToLower(c.Text) {
+		case "modulnr", "modulnr.", "modul-nr.":
+			kind = "id"
+		case "name", "modul", "modulname":
+			kind = "name"
+		case "cp", "credits":
+			kind = "cp"
+		case "note":
+			kind = "grade"
+		default:
+			continue
+		}
+		kinds[kind] = true
+		cols = append(cols, column{Kind: kind, Start: c.X})
+	}
+	if !kinds["id"] || !kinds["name"] || !kinds["grade"] {
+		return nil
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].Start < cols[j].Start })
+	return cols
+}
+
+// split assigns every glyph of a line to a column and returns the text per column kind.
+func split(cols []column, l textLine) map[string]string {
+	byKind := map[string][]pdf.Text{}
+	for _, g := range l.Glyphs {
+		kind := ""
+		for i, c := range cols {
+			if i == 0 || g.X >= c.Start-columnMargin*glyphSize(g) {
+				kind = c.Kind
+			}
+		}
+		byKind[kind] = append(byKind[kind], g)
+	}
+
+	fields := map[string]string{}
+	for kind, glyphs := range byKind {
+		fields[kind] = joinGlyphs(glyphs)
+	}
+	return fields
+}
+
+func isFooter(text string) bool {
+	return strings.HasPrefix(text, "Diese Notenübersicht ist kein Zeugnis") ||
+		strings.HasPrefix(text, "Der derzeitige Notendurchschnitt")
+}
+
+// extractGradesLayout builds the grade list from the lines of every page.
+func extractGradesLayout(pages [][]textLine) ([]Grade, error) {
+	var grades []Grade
+	moduleOccurrences := make(map[string]int)
+
+	var cols []column
+	var nameParts, gradeParts []string
+	var lastY float64
+	inRow := false
+
+	flush := func() {
+		if !inRow {
+			return
+		}
+		inRow = false
+
+		name := normalizeString(strings.Join(nameParts, " "))
+		if name == "" {
+			name = "Unknown"
+		}
+		gradeStr := strings.Join(gradeParts, " ")
+		if gradeStr == "" {
+			gradeStr = "?"
+		}
+
+		idx := moduleOccurrences[name]
+		moduleOccurrences[name]++
+		grades = append(grades, Grade{
+			Module:          name,
+			Grade:           gradeStr,
+			OccurrenceIndex: idx,
+		})
+	}
+
+pages:
+	for _, lines := range pages {
+		// Page headers above the table are skipped until the (repeated)
+		// table header. Pages without one continue the previous table.
+		inTable := cols != nil && headerless(lines)
+
+		for _, l := range lines {
+			if isFooter(joinGlyphs(l.Glyphs)) {
+				break pages
+			}
+			if h := headerColumns(l); h != nil {
+				flush()
+				cols, inTable = h, true
+				continue
+			}
+			if !inTable {
+				continue
+			}
+
+			fields := split(cols, l)
+			if id := fields["id"]; reID.MatchString(id) {
+				flush()
+				inRow = true
+				nameParts, gradeParts = nil, nil
+			} else if !inRow || lastY-l.Y > rowGap*l.Size {
+				// Not part of a table row (page numbers, notes, ...)
+				flush()
+				continue
+			}
+
+			if v := fields["name"]; v != "" {
+				nameParts = append(nameParts, v)
+			}
+			if v := fields["grade"]; v != "" {
+				gradeParts = append(gradeParts, v)
+			}
+			lastY = l.Y
+		}
+		flush()
+	}
+	flush()
+
+	if cols == nil {
+		return nil, errNoTable
+	}
+	return grades, nil
+}
+
+// headerless reports whether a page has no table header of its own.
+func headerless(lines []textLine) bool {
+	for _, l := range lines {
+		if headerColumns(l) != nil {
+			return false
+		}
+	}
+	return true
+}
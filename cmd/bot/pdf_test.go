@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// glyphs lays out s as single-character glyphs starting at (x, y),
+// each 5pt wide in a 10pt font.
+func glyphs(x, y float64, s string) []pdf.Text {
+	var out []pdf.Text
+	for _, r := range s {
+		out = append(out, pdf.Text{FontSize: 10, X: x, Y: y, W: 5, S: string(r)})
+		x += 5
+	}
+	return out
+}
+
+func TestExtractGradesLayout(t *testing.T) {
+	var texts []pdf.Text
+	add := func(x, y float64, s string) { texts = append(texts, glyphs(x, y, s)...) }
+
+	add(50, 800, "Notenübersicht")
+	add(50, 700, "ModulNr")
+	add(120, 700, "Name")
+	add(400, 700, "CP")
+	add(460, 700, "Note")
+
+	add(50, 680, "I101")
+	add(120, 680, "Mathematik I")
+	add(400, 680, "6 CP")
+	add(460, 680, "1,7")
+
+	// Module name wrapped onto a second line
+	add(50, 665, "I102")
+	add(120, 665, "Grundlagen der")
+	add(400, 665, "6 CP")
+	add(460, 665, "bestanden")
+	add(120, 653, "Wirtschaftsinformatik")
+
+	add(50, 638, "I103")
+	add(120, 638, "Mathematik I")
+	add(400, 638, "6 CP")
+	add(460, 638, "2,0")
+
+	add(250, 400, "Seite 1 von 1")
+	add(50, 380, "Diese Notenübersicht ist kein Zeugnis.")
+
+	got, err := extractGradesLayout([][]textLine{groupLines(texts)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Grade{
+		{Module: "Mathematik I", Grade: "1,7", OccurrenceIndex: 0},
+		{Module: "Grundlagen der Wirtschaftsinformatik", Grade: "bestanden", OccurrenceIndex: 0},
+		{Module: "Mathematik I", Grade: "2,0", OccurrenceIndex: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d grades, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("grade %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExtractGradesLayoutWithoutTable(t *testing.T) {
+	lines := groupLines(glyphs(50, 700, "Keine Ergebnisse"))
+	if _, err := extractGradesLayout([][]textLine{lines}); err != errNoTable {
+		t.Errorf("err = %v, want errNoTable", err)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"gradechecker/pkg/config"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when the next check cycle runs.
+type Schedule interface {
+	// Next returns the first planned run after t.
+	Next(t time.Time) time.Time
+}
+
+// loadSchedule builds the check schedule from the configuration (see
+// config.Check). Invalid expressions are reported as *config.FieldError.
+func loadSchedule(cfg *config.Config) (*plan, error) {
+	p := &plan{jitter: time.Duration(cfg.Check.Jitter)}
+	var err error
+
+	if expr := strings.TrimSpace(cfg.Check.Schedule); expr != "" {
+		if p.base, err = parseSchedule(expr); err != nil {
+			return nil, cfg.Invalid("check.schedule", "%v", err)
+		}
+	} else {
+		p.base = every(cfg.Check.Interval)
+	}
+
+	for i, o := range cfg.Check.Overrides {
+		ov, err := newOverride(o)
+		if err != nil {
+			return nil, cfg.Invalid(fmt.Sprintf("check.overrides[%d]", i), "%v", err)
+		}
+		p.overrides = append(p.overrides, ov)
+	}
+	return p, nil
+}
+
+// parseSchedule parses a five-field cron expression or "@every <duration>".
+func parseSchedule(expr string) (Schedule, error) {
+	if d, ok := strings.CutPrefix(expr, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || interval < time.Minute {
+			return nil, fmt.Errorf("%q: @every needs a duration of at least 1m", expr)
+		}
+		return every(interval), nil
+	}
+	return parseCron(expr)
+}
+
+// every runs at a fixed interval.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+// override replaces the base schedule between two dates (both inclusive).
+type override struct {
+	from, until time.Time // until is the midnight after the last day
+	sched       Schedule
+}
+
+func newOverride(o config.Override) (override, error) {
+	var ov override
+	var err error
+	if ov.from, err = time.ParseInLocation(time.DateOnly, o.From, time.Local); err != nil {
+		return override{}, err
+	}
+	if ov.until, err = time.ParseInLocation(time.DateOnly, o.To, time.Local); err != nil {
+		return override{}, err
+	}
+	ov.until = ov.until.AddDate(0, 0, 1)
+	if !ov.from.Before(ov.until) {
+		return override{}, fmt.Errorf("%s..%s: range ends before it starts", o.From, o.To)
+	}
+	if ov.sched, err = parseSchedule(strings.TrimSpace(o.Schedule)); err != nil {
+		return override{}, err
+	}
+	return ov, nil
+}
+
+// plan is the base schedule with its date-ranged overrides and jitter.
+type plan struct {
+	base      Schedule
+	overrides []override
+	jitter    time.Duration
+}
+
+// at returns the schedule active at t and the time it stops being active
+// (zero if it stays active).
+func (p *plan) at(t time.Time) (Schedule, time.Time) {
+	sched := p.base
+	var until time.Time
+	for _, o := range p.overrides {
+		if !t.Before(o.from) && t.Before(o.until) {
+			// The first matching override wins for as long as it lasts
+			return o.sched, o.until
+		}
+		if o.from.After(t) && (until.IsZero() || o.from.Before(until)) {
+			until = o.from
+		}
+	}
+	return sched, until
+}
+
+// Next returns the next planned run after t without jitter. When an
+// override starts or ends before the active schedule's next run, the
+// following schedule takes over at that point.
+func (p *plan) Next(t time.Time) time.Time {
+	sched, until := p.at(t)
+	next := sched.Next(t)
+	for i := 0; i <= len(p.overrides) && !until.IsZero() && !next.Before(until); i++ {
+		t = until
+		sched, until = p.at(t)
+		// A cron run exactly at the boundary belongs to the new schedule.
+		next = sched.Next(t.Add(-time.Nanosecond))
+		if _, ok := sched.(every); ok {
+			next = t
+		}
+	}
+	return next
+}
+
+// NextJittered returns the next run with the random jitter added.
+func (p *plan) NextJittered(t time.Time) time.Time {
+	next := p.Next(t)
+	if p.jitter > 0 {
+		next = next.Add(rand.N(p.jitter))
+	}
+	return next
+}
+
+// cron is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week. Each field is a bit set of the allowed values.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a "*" day field. As in cron, a run happens
+	// when either day field matches unless one of them is "*".
+	domAny, dowAny bool
+}
+
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+func parseCron(expr string) (*cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%q: expected 5 fields (minute hour day month weekday), got %d", expr, len(fields))
+	}
+
+	c := &cron{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	specs := []struct {
+		name     string
+		bits     *uint64
+		min, max int
+		names    []string
+	}{
+		{"minute", &c.minute, 0, 59, nil},
+		{"hour", &c.hour, 0, 23, nil},
+		{"day", &c.dom, 1, 31, nil},
+		{"month", &c.month, 1, 12, monthNames},
+		{"weekday", &c.dow, 0, 7, dayNames},
+	}
+	for i, s := range specs {
+		bits, err := parseCronField(fields[i], s.min, s.max, s.names)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %s: %w", expr, s.name, err)
+		}
+		*s.bits = bits
+	}
+	// Sunday can be written as 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%q never matches", expr)
+	}
+	return c, nil
+}
+
+// parseCronField parses a comma-separated list of "*", "N", "N-M" and
+// names, each optionally followed by "/STEP".
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return i + min, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q is not a value between %d and %d", s, min, max)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		lo, hi := min, max
+		switch from, to, isRange := strings.Cut(rng, "-"); {
+		case rng == "*":
+		case isRange:
+			var err error
+			if lo, err = value(from); err != nil {
+				return 0, err
+			}
+			if hi, err = value(to); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("range %q ends before it starts", rng)
+			}
+		default:
+			var err error
+			if lo, err = value(rng); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if hasStep {
+				hi = max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first minute after t matching the expression, or the
+// zero time if there is none within five years (e.g. "0 0 30 2 *").
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"gradechecker/pkg/config"
+	"os"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr, from, want string
+	}{
+		{"*/10 8-20 * * 1-5", "2026-07-06 08:03", "2026-07-06 08:10"}, // Monday
+		{"*/10 8-20 * * 1-5", "2026-07-06 20:55", "2026-07-07 08:00"},
+		{"*/10 8-20 * * 1-5", "2026-07-10 21:00", "2026-07-13 08:00"}, // Friday evening
+		{"0 12 * * sun", "2026-07-06 12:00", "2026-07-12 12:00"},
+		{"0 12 * * 7", "2026-07-06 12:00", "2026-07-12 12:00"},
+		{"30 6 1,15 * *", "2026-07-02 00:00", "2026-07-15 06:30"},
+		{"0 0 1 jan *", "2026-07-02 00:00", "2027-01-01 00:00"},
+		{"0 0 13 * fri", "2026-07-01 00:00", "2026-07-03 00:00"}, // either day field matches
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := c.Next(date(tt.from)); !got.Equal(date(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestPlanOverrides(t *testing.T) {
+	t.Setenv("CHECK_SCHEDULE", "0 8 * * *")
+	t.Setenv("CHECK_SCHEDULE_OVERRIDES", "2026-07-01..2026-07-20=*/5 * * * *")
+	cfg, err := config.Load("", os.Getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadSchedule(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ from, want string }{
+		{"2026-06-29 09:00", "2026-06-30 08:00"},
+		{"2026-06-30 09:00", "2026-07-01 00:00"}, // override starts before the next base run
+		{"2026-07-10 13:02", "2026-07-10 13:05"},
+		{"2026-07-20 23:57", "2026-07-21 08:00"}, // last day is included
+	}
+	for _, tt := range tests {
+		if got := p.Next(date(tt.from)); !got.Equal(date(tt.want)) {
+			t.Errorf("after %s = %s, want %s", tt.from, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migrations brings the database schema up to date.
+// Entry i upgrades the schema from version i to i+1; the current version is
+// stored in PRAGMA user_version. Never edit an entry once released, append a
+// new one instead.
+var migrations = []string{
+	// 1: initial schema (also created by the dashboard in src/lib/db.ts)
+	`CREATE TABLE IF NOT EXISTS grades_v2 (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		module_name TEXT NOT NULL,
+		grade TEXT,
+		occurrence_index INTEGER,
+		status TEXT,
+		updated_at TEXT,
+		UNIQUE(module_name, occurrence_index)
+	);
+	CREATE TABLE IF NOT EXISTS system_status (
+		key TEXT PRIMARY KEY,
+		value TEXT,
+		updated_at TEXT
+	);`,
+
+	// 2: grade rows belong to an account
+	`CREATE TABLE grades_v2_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account TEXT NOT NULL DEFAULT 'default',
+		module_name TEXT NOT NULL,
+		grade TEXT,
+		occurrence_index INTEGER,
+		status TEXT,
+		updated_at TEXT,
+		UNIQUE(account, module_name, occurrence_index)
+	);
+	INSERT INTO grades_v2_new (id, module_name, grade, occurrence_index, status, updated_at)
+		SELECT id, module_name, grade, occurrence_index, status, updated_at FROM grades_v2;
+	DROP TABLE grades_v2;
+	ALTER TABLE grades_v2_new RENAME TO grades_v2;`,
+
+	// 3: notifications are queued in the cycle's transaction and sent after commit
+	`CREATE TABLE outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account TEXT NOT NULL,
+		backend TEXT NOT NULL,
+		message TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at TEXT,
+		sent_at TEXT
+	);
+	CREATE INDEX outbox_pending ON outbox (sent_at, next_attempt_at);`,
+
+	// 4: history of every grade; existing grades start with a "new" event
+	`CREATE TABLE grade_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account TEXT NOT NULL,
+		module_name TEXT NOT NULL,
+		occurrence_index INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		grade TEXT NOT NULL DEFAULT '',
+		previous_grade TEXT NOT NULL DEFAULT '',
+		silent INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX grade_events_grade ON grade_events (account, module_name, occurrence_index);
+	INSERT INTO grade_events (account, module_name, occurrence_index, type, grade, silent, created_at)
+		SELECT account, module_name, occurrence_index, 'new', COALESCE(grade, ''), 1, COALESCE(updated_at, '')
+		FROM grades_v2 ORDER BY updated_at;`,
+
+	// 5: grades and events reference a module catalog instead of a module name;
+	// module_name stays as the module's name for the dashboard
+	`CREATE TABLE modules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		credits REAL,
+		semester INTEGER
+	);
+	CREATE TABLE module_aliases (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		module_id INTEGER NOT NULL REFERENCES modules(id),
+		name TEXT NOT NULL UNIQUE
+	);
+	INSERT INTO modules (name)
+		SELECT module_name FROM grades_v2 UNION SELECT module_name FROM grade_events ORDER BY 1;
+	CREATE TABLE grades_v2_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account TEXT NOT NULL DEFAULT 'default',
+		module_id INTEGER NOT NULL REFERENCES modules(id),
+		module_name TEXT NOT NULL,
+		grade TEXT,
+		occurrence_index INTEGER,
+		status TEXT,
+		updated_at TEXT,
+		UNIQUE(account, module_id, occurrence_index)
+	);
+	INSERT INTO grades_v2_new (id, account, module_id, module_name, grade, occurrence_index, status, updated_at)
+		SELECT g.id, g.account, m.id, g.module_name, g.grade, g.occurrence_index, g.status, g.updated_at
+		FROM grades_v2 g JOIN modules m ON m.name = g.module_name;
+	DROP TABLE grades_v2;
+	ALTER TABLE grades_v2_new RENAME TO grades_v2;
+	ALTER TABLE grade_events ADD COLUMN module_id INTEGER REFERENCES modules(id);
+	UPDATE grade_events SET module_id = (SELECT id FROM modules WHERE name = grade_events.module_name);
+	CREATE INDEX grade_events_module ON grade_events (account, module_id, occurrence_index);`,
+}
+
+// schemaVersion is the version a fully migrated database reports.
+var schemaVersion = len(migrations)
+
+// migrate applies all pending migrations, each in its own transaction.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		slog.Info("Migrating database schema", "version", i+1)
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not accept bound parameters.
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateKeepsExistingGrades(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "grades.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A database created by an older bot (schema version 1)
+	if _, err := db.Exec(migrations[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO grades_v2 (module_name, grade, occurrence_index, status, updated_at)
+		VALUES ('Mathematik', '1,3', 0, 'new', '2025-01-01T00:00:00Z')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	// Running it again must be a no-op
+	if err := migrate(db); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != schemaVersion {
+		t.Errorf("user_version = %d, want %d", version, schemaVersion)
+	}
+
+	var account, grade, module string
+	err = db.QueryRow(`SELECT g.account, g.grade, m.name FROM grades_v2 g JOIN modules m ON m.id = g.module_id
+		WHERE g.module_name = 'Mathematik'`).Scan(&account, &grade, &module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account != defaultAccount || grade != "1,3" || module != "Mathematik" {
+		t.Errorf("got (%q, %q, %q), want (%q, %q, %q)", account, grade, module, defaultAccount, "1,3", "Mathematik")
+	}
+	var events int
+	if err := db.QueryRow("SELECT COUNT(*) FROM grade_events WHERE module_id IS NOT NULL").Scan(&events); err != nil || events != 1 {
+		t.Errorf("%d events with a module, want the initial one (%v)", events, err)
+	}
+}
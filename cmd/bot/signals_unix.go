@@ -0,0 +1,22 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySignals subscribes to the signals the daemon reacts to.
+func notifySignals() daemonSignals {
+	s := daemonSignals{
+		stop:   make(chan os.Signal, 1),
+		check:  make(chan os.Signal, 1),
+		reload: make(chan os.Signal, 1),
+	}
+	signal.Notify(s.stop, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(s.check, syscall.SIGUSR1)
+	signal.Notify(s.reload, syscall.SIGHUP)
+	return s
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifySignals subscribes to the signals the daemon reacts to. Windows has
+// no SIGUSR1 or SIGHUP, so on-demand checks and reloads are not available.
+func notifySignals() daemonSignals {
+	s := daemonSignals{stop: make(chan os.Signal, 1)}
+	signal.Notify(s.stop, os.Interrupt, syscall.SIGTERM)
+	return s
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// resultsURL is the HTML exam results overview the transcript PDF is linked from.
+const resultsURL = "https://cis.nordakademie.de/studium/pruefungen/pruefungsergebnisse"
+
+// GradeSource fetches the current grades of an account from CIS.
+// Implementations take care of logging in when the session has expired.
+type GradeSource interface {
+	Name() string
+	Fetch(ctx context.Context, client *http.Client, acc Account) ([]Grade, error)
+}
+
+// sourcesFor returns the grade sources configured for an account.
+// GRADE_SOURCE selects "pdf" (default), "html" or "both"; with "both" the
+// first source is authoritative and the second is used for cross-checking.
+func sourcesFor(acc Account) ([]GradeSource, error) {
+	switch acc.Source {
+	case "", "pdf":
+		return []GradeSource{pdfSource{}}, nil
+	case "html":
+		return []GradeSource{htmlSource{}}, nil
+	case "both":
+		return []GradeSource{pdfSource{}, htmlSource{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown GRADE_SOURCE %q (expected pdf, html or both)", acc.Source)
+	}
+}
+
+// fetchGrades reads the grades of an account from all configured sources.
+// When more than one source is configured the results are cross-checked and
+// disagreements are logged as warnings.
+func fetchGrades(ctx context.Context, client *http.Client, acc Account) ([]Grade, error) {
+	sources, err := sourcesFor(acc)
+	if err != nil {
+		return nil, err
+	}
+
+	var primary []Grade
+	var primaryName string
+	var errs []error
+	for _, src := range sources {
+		grades, err := src.Fetch(ctx, client, acc)
+		if err != nil {
+			if len(sources) == 1 || ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, err)
+			slog.Warn("Grade source failed", "account", acc.Name, "source", src.Name(), "err", err)
+			continue
+		}
+		slog.Info("Found grades", "account", acc.Name, "source", src.Name(), "count", len(grades))
+
+		if primaryName == "" {
+			primary, primaryName = grades, src.Name()
+			continue
+		}
+		for _, diff := range crossCheck(primary, grades) {
+			slog.Warn("Grade sources disagree", "account", acc.Name, "sources", primaryName+","+src.Name(), "difference", diff)
+		}
+	}
+
+	if primaryName == "" {
+		return nil, fmt.Errorf("all grade sources failed: %w", errors.Join(errs...))
+	}
+	return primary, nil
+}
+
+// crossCheck compares two grade lists and describes every disagreement.
+func crossCheck(a, b []Grade) []string {
+	key := func(g Grade) string {
+		return g.Module + "#" + strconv.Itoa(g.OccurrenceIndex)
+	}
+	inB := make(map[string]Grade, len(b))
+	for _, g := range b {
+		inB[key(g)] = g
+	}
+
+	var diffs []string
+	for _, g := range a {
+		other, ok := inB[key(g)]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s (#%d) only in first source", g.Module, g.OccurrenceIndex))
+			continue
+		}
+		delete(inB, key(g))
+		if strings.Join(strings.Fields(g.Grade), " ") != strings.Join(strings.Fields(other.Grade), " ") {
+			diffs = append(diffs, fmt.Sprintf("%s (#%d): %q vs %q", g.Module, g.OccurrenceIndex, g.Grade, other.Grade))
+		}
+	}
+	for _, g := range b {
+		if _, ok := inB[key(g)]; ok {
+			diffs = append(diffs, fmt.Sprintf("%s (#%d) only in second source", g.Module, g.OccurrenceIndex))
+		}
+	}
+	return diffs
+}
+
+// fetchWithLogin downloads target with the account's session. If valid
+// reports that the response is not what we asked for (usually the login
+// page), it logs in and retries once.
+func fetchWithLogin(ctx context.Context, client *http.Client, acc Account, target string, valid func(resp *http.Response, body []byte) bool) ([]byte, error) {
+	slog.Debug("Checking session validity", "account", acc.Name)
+	body, resp, err := get(ctx, client, target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to access %s: %w", errNetwork, target, err)
+	}
+
+	if !valid(resp, body) {
+		slog.Info("Session expired or invalid, logging in", "account", acc.Name)
+
+		if err := performLogin(ctx, client, acc.Username, acc.Password); err != nil {
+			loginAttempts.Inc("failure")
+			if errors.Is(err, errNetwork) {
+				return nil, fmt.Errorf("login failed: %w", err)
+			}
+			return nil, fmt.Errorf("%w: %w", errAuth, err)
+		}
+		loginAttempts.Inc("success")
+		bus.Publish(busSessionRenewed, map[string]string{"account": acc.Name})
+
+		slog.Debug("Retrying download", "account", acc.Name)
+		body, resp, err = get(ctx, client, target)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to download after login: %w", errNetwork, err)
+		}
+		if !valid(resp, body) {
+			return nil, fmt.Errorf("%w: still not logged in after login (status %d, %s)", errAuth, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	} else {
+		slog.Debug("Session is valid", "account", acc.Name)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("%w: download failed, status: %d", errNetwork, resp.StatusCode)
+	}
+	return body, nil
+}
+
+func get(ctx context.Context, client *http.Client, target string) ([]byte, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := downloadWithProgress(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, resp, nil
+}
+
+// pdfSource reads grades from the transcript PDF ("Notenübersicht").
+type pdfSource struct{}
+
+func (pdfSource) Name() string { return "pdf" }
+
+func (pdfSource) Fetch(ctx context.Context, client *http.Client, acc Account) ([]Grade, error) {
+	start := time.Now()
+	pdfData, err := fetchWithLogin(ctx, client, acc, acc.TranscriptURL, func(resp *http.Response, _ []byte) bool {
+		return strings.Contains(resp.Header.Get("Content-Type"), "application/pdf")
+	})
+	if err != nil {
+		return nil, err
+	}
+	downloadDuration.Since(start)
+	downloadBytes.Add(float64(len(pdfData)))
+
+	if err := writePrivateFile(acc.PDFFile, pdfData); err != nil {
+		return nil, err
+	}
+	slog.Info("PDF downloaded", "account", acc.Name, "bytes", len(pdfData))
+
+	slog.Debug("Parsing PDF", "account", acc.Name)
+	start = time.Now()
+	grades, err := parsePdf(acc.PDFFile, acc.Label())
+	parseDuration.Since(start, "pdf")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errParse, err)
+	}
+	return grades, nil
+}
+
+// htmlSource reads grades from the HTML results overview ("Prüfungsergebnisse").
+type htmlSource struct{}
+
+func (htmlSource) Name() string { return "html" }
+
+func (htmlSource) Fetch(ctx context.Context, client *http.Client, acc Account) ([]Grade, error) {
+	page, err := fetchWithLogin(ctx, client, acc, acc.ResultsURL, func(resp *http.Response, body []byte) bool {
+		return !bytes.Contains(body, []byte(`name="user"`))
+	})
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	grades, err := extractGradesHTML(bytes.NewReader(page))
+	parseDuration.Since(start, "html")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errParse, err)
+	}
+	return grades, nil
+}
+
+// extractGradesHTML parses the results tables of the Prüfungsergebnisse page.
+// Columns are located by their header text so reordered or additional
+// columns do not break parsing.
+func extractGradesHTML(r io.Reader) ([]Grade, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var grades []Grade
+	moduleOccurrences := make(map[string]int)
+
+	doc.Find("table").Each(func(_ int, table *goquery.Selection) {
+		idCol, nameCol, gradeCol := -1, -1, -1
+		table.Find("tr").EachWithBreak(func(_ int, row *goquery.Selection) bool {
+			if row.Find("th").Length() == 0 {
+				return true
+			}
+			row.Find("th").Each(func(i int, cell *goquery.Selection) {
+				switch h := strings.ToLower(cellText(cell)); {
+				case strings.Contains(h, "modulnr") || strings.Contains(h, "nr."):
+					idCol = i
+				case h == "name" || h == "modul" || strings.Contains(h, "bezeichnung"):
+					nameCol = i
+				case h == "note" || strings.Contains(h, "bewertung"):
+					gradeCol = i
+				}
+			})
+			return false
+		})
+		if nameCol < 0 || gradeCol < 0 {
+			return
+		}
+
+		table.Find("tr").Each(func(_ int, row *goquery.Selection) {
+			cells := row.Find("td")
+			if cells.Length() <= max(idCol, nameCol, gradeCol) {
+				return
+			}
+			if idCol >= 0 && !reID.MatchString(cellText(cells.Eq(idCol))) {
+				return
+			}
+
+			name := normalizeString(cellText(cells.Eq(nameCol)))
+			if name == "" {
+				return
+			}
+			gradeStr := cellText(cells.Eq(gradeCol))
+			if gradeStr == "" {
+				gradeStr = "?"
+			}
+
+			idx := moduleOccurrences[name]
+			moduleOccurrences[name]++
+			grades = append(grades, Grade{
+				Module:          name,
+				Grade:           gradeStr,
+				OccurrenceIndex: idx,
+			})
+		})
+	})
+
+	if len(grades) == 0 {
+		return nil, fmt.Errorf("no results table found")
+	}
+	return grades, nil
+}
+
+// cellText returns the whitespace-collapsed text of a table cell.
+func cellText(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const resultsPage = `<html><body>
+<table>
+	<tr><th>ModulNr</th><th>Name</th><th>CP</th><th>Note</th></tr>
+	<tr><td>I101</td><td>Mathematik I</td><td>6 CP</td><td>1,7</td></tr>
+	<tr><td>I102</td><td>Programmierung&#8203; I</td><td>6 CP</td><td> 5,0 </td></tr>
+	<tr><td>I102</td><td>Programmierung I</td><td>6 CP</td><td>2,3</td></tr>
+	<tr><td colspan="4">Summe</td></tr>
+</table>
+</body></html>`
+
+func TestExtractGradesHTML(t *testing.T) {
+	grades, err := extractGradesHTML(strings.NewReader(resultsPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Grade{
+		{Module: "Mathematik I", Grade: "1,7", OccurrenceIndex: 0},
+		{Module: "Programmierung I", Grade: "5,0", OccurrenceIndex: 0},
+		{Module: "Programmierung I", Grade: "2,3", OccurrenceIndex: 1},
+	}
+	if len(grades) != len(want) {
+		t.Fatalf("got %d grades, want %d: %+v", len(grades), len(want), grades)
+	}
+	for i := range want {
+		if grades[i] != want[i] {
+			t.Errorf("grade %d = %+v, want %+v", i, grades[i], want[i])
+		}
+	}
+}
+
+func TestCrossCheck(t *testing.T) {
+	pdf := []Grade{
+		{Module: "Mathematik I", Grade: "1,7"},
+		{Module: "Statistik", Grade: "2,0"},
+	}
+	html := []Grade{
+		{Module: "Mathematik I", Grade: "1,7"},
+		{Module: "Statistik", Grade: "2,3"},
+		{Module: "BWL", Grade: "#"},
+	}
+
+	diffs := crossCheck(pdf, html)
+	if len(diffs) != 2 {
+		t.Fatalf("got %d differences, want 2: %v", len(diffs), diffs)
+	}
+	if crossCheck(pdf, pdf) != nil {
+		t.Error("identical lists should not disagree")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+var (
+	// errNotFound is returned for a row that does not exist.
+	errNotFound = errors.New("not found")
+	// errModuleConflict is returned for merging two modules that are both
+	// on a transcript.
+	errModuleConflict = errors.New("both modules have a current grade")
+)
+
+// Store is the database of the bot. It is implemented for SQLite (the
+// grades.db file) and PostgreSQL, selected by database.url. Grades and
+// notification messages are encrypted and decrypted by the store (see
+// sealValue), so callers always see plain values.
+type Store interface {
+	GradeStore
+	EventStore
+	ModuleStore
+	StatusStore
+	OutboxStore
+
+	// Tx runs fn in a transaction, which is committed if fn returns nil and
+	// rolled back otherwise. Called on the store passed to fn, it runs fn in
+	// the same transaction.
+	Tx(ctx context.Context, fn func(tx Store) error) error
+
+	// SchemaVersion returns the version of the schema, 0 for an empty
+	// database; Migrate brings it up to schemaVersion.
+	SchemaVersion(ctx context.Context) (int, error)
+	Migrate(ctx context.Context) error
+
+	// Reseal passes every encrypted column (see sealedColumns) through fn
+	// and stores the result, in one transaction. It returns the number of
+	// values changed.
+	Reseal(ctx context.Context, fn func(value string) (string, error)) (int, error)
+	// Compact rewrites the database outside of a transaction, so that the
+	// values replaced by Reseal do not remain readable in its free space.
+	// It does nothing on PostgreSQL.
+	Compact(ctx context.Context) error
+
+	// Ping checks that the database can be reached.
+	Ping(ctx context.Context) error
+	// Backend is "sqlite" or "postgres".
+	Backend() string
+	// Name describes the database in messages, without credentials.
+	Name() string
+	Close() error
+}
+
+// GradeStore holds the current grade of every module attempt (grades_v2).
+// Grades refer to a module of the catalog by its name or one of its
+// aliases, and are returned with the module's name (see ModuleStore).
+type GradeStore interface {
+	// Grades returns the grades of an account (all accounts if empty) whose
+	// module name or an alias of it contains module, ordered by account,
+	// module and attempt.
+	Grades(ctx context.Context, account, module string) ([]storedGrade, error)
+	// Grade returns a grade by ID, or errNotFound.
+	Grade(ctx context.Context, id int64) (storedGrade, error)
+	// InsertGrade stores a grade, adding its module to the catalog if there
+	// is none of that name.
+	InsertGrade(ctx context.Context, g storedGrade) error
+	// UpdateGrade stores the grade, status and time of the row with the same
+	// account, module and attempt.
+	UpdateGrade(ctx context.Context, g storedGrade) error
+}
+
+// EventStore holds the history of every grade (grade_events).
+type EventStore interface {
+	// AddEvent appends an event; its Time must be set.
+	AddEvent(ctx context.Context, e GradeEvent) error
+	// Events returns the history of a grade, oldest first.
+	Events(ctx context.Context, account, module string, occurrence int) ([]GradeEvent, error)
+	// AccountEvents returns the history of an account (all accounts if
+	// empty) in the order it was recorded.
+	AccountEvents(ctx context.Context, account string) ([]GradeEvent, error)
+	// ReplaceEvents replaces the history of an account.
+	ReplaceEvents(ctx context.Context, account string, events []GradeEvent) error
+	// EventCounts counts the events by type.
+	EventCounts(ctx context.Context) (map[string]int, error)
+}
+
+// ModuleStore holds the module catalog (modules and module_aliases). Every
+// module has a unique name, and the names of all modules and aliases are
+// unique, so a name identifies at most one module.
+type ModuleStore interface {
+	// Modules returns the catalog ordered by name.
+	Modules(ctx context.Context) ([]Module, error)
+	// Module returns a module by ID, or errNotFound.
+	Module(ctx context.Context, id int64) (Module, error)
+	AddModule(ctx context.Context, name string) (Module, error)
+	// AddAlias records another name of a module.
+	AddAlias(ctx context.Context, id int64, name string) error
+	// UpdateModule stores the name, credits and semester of a module. A
+	// changed name is also changed on the grades, and the previous name
+	// becomes an alias. The name must not be one of another module.
+	UpdateModule(ctx context.Context, m Module) error
+	// MergeModules moves the grades, history and aliases of module from to
+	// module into, which keeps its name, and deletes from. Of two grades of
+	// the same account and attempt the removed or else the older one is
+	// dropped; if neither is removed it fails with errModuleConflict.
+	MergeModules(ctx context.Context, into, from int64) error
+}
+
+// StatusStore holds small values about the state of the bot
+// (system_status), which the dashboard shows.
+type StatusStore interface {
+	// Status returns the value of a key, "" if it is not set.
+	Status(ctx context.Context, key string) (string, error)
+	Statuses(ctx context.Context) (map[string]string, error)
+	SetStatus(ctx context.Context, key, value string) error
+	// DeleteStatus removes a key and reports whether it was set.
+	DeleteStatus(ctx context.Context, key string) (bool, error)
+
+	// AcquireLease takes or renews the leader lease for holder. It fails
+	// with errLocked if another holder renewed its lease within
+	// leaseDuration before at.
+	AcquireLease(ctx context.Context, holder string, at time.Time) error
+	// ReleaseLease gives up the lease if holder has it.
+	ReleaseLease(ctx context.Context, holder string) error
+}
+
+// OutboxStore holds the queued notifications (outbox).
+type OutboxStore interface {
+	Enqueue(ctx context.Context, account, backend, message string) error
+	// DueNotifications returns the undelivered notifications whose next
+	// attempt is due and that have been tried less than maxOutboxAttempts
+	// times, oldest first.
+	DueNotifications(ctx context.Context) ([]outboxEntry, error)
+	MarkSent(ctx context.Context, id int64) error
+	// MarkFailed records a failed attempt and when to try again.
+	MarkFailed(ctx context.Context, id int64, reason string, retry time.Time) error
+	// PurgeOutbox deletes the delivered notifications queued before a time.
+	PurgeOutbox(ctx context.Context, before time.Time) error
+	// OutboxCounts counts the undelivered notifications that are still
+	// retried and those that were given up.
+	OutboxCounts(ctx context.Context) (pending, failed int, err error)
+}
+
+// outboxEntry is a queued notification.
+type outboxEntry struct {
+	ID       int64
+	Account  string
+	Backend  string
+	Message  string
+	Attempts int
+}
+
+// connectDB connects to the configured database without changing it.
+func connectDB(ctx context.Context) (Store, error) {
+	dsn, err := resolveSecret(ctx, currentConfig().Database.URL)
+	if err != nil {
+		return nil, fmt.Errorf("database.url: %w", err)
+	}
+	if dsn == "" {
+		return openSQLite(dbFile)
+	}
+	if u, err := url.Parse(dsn); err == nil {
+		if password, ok := u.User.Password(); ok {
+			secrets.add(password)
+		}
+	}
+	return openPostgres(dsn)
+}
+
+// openDB connects to the database, brings its schema up to date and loads
+// the encryption key.
+func openDB() (Store, error) {
+	ctx := context.Background()
+	db, err := connectDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// The database holds grades, so only the owner may read it
+	if db.Backend() == "sqlite" {
+		if err := os.Chmod(dbFile, 0600); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	if err := setupEncryption(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresMigrations are the migrations for PostgreSQL, numbered like
+// migrations so that both backends report the same schema version. The
+// backend was added at version 4: the first entry creates that schema and
+// the next three are empty. The version is kept in schema_version.
+var postgresMigrations = []string{
+	// 1-4: the schema of SQLite version 4
+	`CREATE TABLE grades_v2 (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		account TEXT NOT NULL DEFAULT 'default',
+		module_name TEXT NOT NULL,
+		grade TEXT,
+		occurrence_index INTEGER,
+		status TEXT,
+		updated_at TEXT,
+		UNIQUE(account, module_name, occurrence_index)
+	);
+	CREATE TABLE system_status (
+		key TEXT PRIMARY KEY,
+		value TEXT,
+		updated_at TEXT
+	);
+	CREATE TABLE outbox (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		account TEXT NOT NULL,
+		backend TEXT NOT NULL,
+		message TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_attempt_at TEXT,
+		sent_at TEXT
+	);
+	CREATE INDEX outbox_pending ON outbox (sent_at, next_attempt_at);
+	CREATE TABLE grade_events (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		account TEXT NOT NULL,
+		module_name TEXT NOT NULL,
+		occurrence_index INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		grade TEXT NOT NULL DEFAULT '',
+		previous_grade TEXT NOT NULL DEFAULT '',
+		silent BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX grade_events_grade ON grade_events (account, module_name, occurrence_index);`,
+	"",
+	"",
+	"",
+
+	// 5: the module catalog, see migrations
+	`CREATE TABLE modules (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		credits DOUBLE PRECISION,
+		semester INTEGER
+	);
+	CREATE TABLE module_aliases (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		module_id BIGINT NOT NULL REFERENCES modules(id),
+		name TEXT NOT NULL UNIQUE
+	);
+	INSERT INTO modules (name)
+		SELECT module_name FROM grades_v2 UNION SELECT module_name FROM grade_events ORDER BY 1;
+	ALTER TABLE grades_v2 ADD COLUMN module_id BIGINT REFERENCES modules(id);
+	UPDATE grades_v2 SET module_id = (SELECT id FROM modules WHERE name = grades_v2.module_name);
+	ALTER TABLE grades_v2 ALTER COLUMN module_id SET NOT NULL;
+	ALTER TABLE grades_v2 DROP CONSTRAINT grades_v2_account_module_name_occurrence_index_key;
+	ALTER TABLE grades_v2 ADD UNIQUE (account, module_id, occurrence_index);
+	ALTER TABLE grade_events ADD COLUMN module_id BIGINT REFERENCES modules(id);
+	UPDATE grade_events SET module_id = (SELECT id FROM modules WHERE name = grade_events.module_name);
+	CREATE INDEX grade_events_module ON grade_events (account, module_id, occurrence_index);`,
+}
+
+var postgresDialect = &dialect{
+	backend:  "postgres",
+	numbered: true,
+	version: func(ctx context.Context, db *sql.DB) (int, error) {
+		return postgresVersion(ctx, db)
+	},
+	migrate: migratePostgres,
+}
+
+// openPostgres connects to a PostgreSQL database given by a postgres:// URL.
+func openPostgres(dsn string) (*sqlStore, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		// The error would show the password
+		return nil, fmt.Errorf("database.url is not a valid URL")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{db: db, dialect: postgresDialect, name: "PostgreSQL database " + u.Host + u.Path}, nil
+}
+
+// postgresVersion reads the schema version, 0 if there is no schema yet.
+func postgresVersion(ctx context.Context, q querier) (int, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT to_regclass('schema_version') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int
+	if err := q.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migratePostgres applies all pending migrations, each in its own
+// transaction. An advisory lock keeps two bots starting at the same time
+// from applying a migration twice.
+func migratePostgres(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)"); err != nil {
+		return fmt.Errorf("creating schema_version: %w", err)
+	}
+	for {
+		done, err := func() (bool, error) {
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return false, err
+			}
+			defer tx.Rollback()
+			if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('gradechecker migrate'))"); err != nil {
+				return false, err
+			}
+			version, err := postgresVersion(ctx, tx)
+			if err != nil || version >= len(postgresMigrations) {
+				return true, err
+			}
+
+			slog.Info("Migrating database schema", "version", version+1)
+			if m := postgresMigrations[version]; m != "" {
+				if _, err := tx.ExecContext(ctx, m); err != nil {
+					return false, fmt.Errorf("migration %d: %w", version+1, err)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO schema_version (version) VALUES ($1)", version+1); err != nil {
+				return false, fmt.Errorf("migration %d: %w", version+1, err)
+			}
+			return false, tx.Commit()
+		}()
+		if err != nil || done {
+			return err
+		}
+	}
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlStore implements Store for both backends. The queries are written
+// with ? placeholders in the SQL both understand; dialect covers the rest.
+type sqlStore struct {
+	db *sql.DB
+	// tx is set on the store passed to a Tx function.
+	tx      *sql.Tx
+	dialect *dialect
+	name    string
+}
+
+// dialect is what differs between the backends.
+type dialect struct {
+	backend string
+	// numbered selects $1, $2, ... placeholders instead of ?.
+	numbered bool
+	version  func(ctx context.Context, db *sql.DB) (int, error)
+	migrate  func(ctx context.Context, db *sql.DB) error
+	// compact rewrites the database so that replaced values are not left
+	// in free space; nil if the backend has nothing to do.
+	compact func(ctx context.Context, db *sql.DB) error
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (s *sqlStore) conn() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// rebind rewrites the ? placeholders of a query for the backend. The
+// queries contain no other question marks.
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.conn().ExecContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.conn().QueryContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.conn().QueryRowContext(ctx, s.rebind(query), args...)
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlStore) Compact(ctx context.Context) error {
+	if s.dialect.compact == nil {
+		return nil
+	}
+	return s.dialect.compact(ctx, s.db)
+}
+
+func (s *sqlStore) Backend() string { return s.dialect.backend }
+func (s *sqlStore) Name() string    { return s.name }
+func (s *sqlStore) Close() error    { return s.db.Close() }
+
+func (s *sqlStore) Tx(ctx context.Context, fn func(tx Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(&sqlStore{db: s.db, tx: tx, dialect: s.dialect, name: s.name}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) SchemaVersion(ctx context.Context) (int, error) {
+	return s.dialect.version(ctx, s.db)
+}
+
+func (s *sqlStore) Migrate(ctx context.Context) error {
+	return s.dialect.migrate(ctx, s.db)
+}
+
+func (s *sqlStore) Reseal(ctx context.Context, fn func(value string) (string, error)) (int, error) {
+	n := 0
+	err := s.Tx(ctx, func(tx Store) error {
+		s := tx.(*sqlStore)
+		for _, c := range sealedColumns {
+			rows, err := s.query(ctx, fmt.Sprintf("SELECT id, %s FROM %s WHERE %[1]s IS NOT NULL AND %[1]s != ''", c.column, c.table))
+			if err != nil {
+				return err
+			}
+			values := make(map[int64]string)
+			for rows.Next() {
+				var id int64
+				var value string
+				if err := rows.Scan(&id, &value); err != nil {
+					rows.Close()
+					return err
+				}
+				values[id] = value
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for id, value := range values {
+				value, err := fn(value)
+				if err != nil {
+					return fmt.Errorf("%s.%s of row %d: %w", c.table, c.column, id, err)
+				}
+				if _, err := s.exec(ctx, fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", c.table, c.column), value, id); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+const gradeColumns = `g.id, g.account, g.module_id, m.name, COALESCE(g.grade, ''), g.occurrence_index, COALESCE(g.status, ''), COALESCE(g.updated_at, '')`
+
+// likeEscaper escapes the wildcards of a LIKE pattern for ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (s *sqlStore) Grades(ctx context.Context, account, module string) ([]storedGrade, error) {
+	module = likeEscaper.Replace(module)
+	rows, err := s.query(ctx, `SELECT `+gradeColumns+` FROM grades_v2 g JOIN modules m ON m.id = g.module_id
+		WHERE (CAST(? AS TEXT) = '' OR g.account = ?) AND (LOWER(m.name) LIKE '%' || LOWER(CAST(? AS TEXT)) || '%' ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM module_aliases a WHERE a.module_id = m.id AND LOWER(a.name) LIKE '%' || LOWER(CAST(? AS TEXT)) || '%' ESCAPE '\'))
+		ORDER BY g.account, m.name, g.occurrence_index`, account, account, module, module)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grades []storedGrade
+	for rows.Next() {
+		g, err := scanGrade(rows)
+		if err != nil {
+			return nil, err
+		}
+		grades = append(grades, g)
+	}
+	return grades, rows.Err()
+}
+
+func (s *sqlStore) Grade(ctx context.Context, id int64) (storedGrade, error) {
+	g, err := scanGrade(s.queryRow(ctx, `SELECT `+gradeColumns+` FROM grades_v2 g JOIN modules m ON m.id = g.module_id WHERE g.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return g, errNotFound
+	}
+	return g, err
+}
+
+// scanGrade reads a grades_v2 row selected with gradeColumns.
+func scanGrade(row interface{ Scan(...any) error }) (storedGrade, error) {
+	var g storedGrade
+	if err := row.Scan(&g.ID, &g.Account, &g.ModuleID, &g.Module, &g.Grade, &g.OccurrenceIndex, &g.Status, &g.UpdatedAt); err != nil {
+		return g, err
+	}
+	var err error
+	g.Grade, err = openValue(g.Grade)
+	return g, err
+}
+
+// moduleID returns the module with a name or alias, adding a module of that
+// name if there is none.
+func (s *sqlStore) moduleID(ctx context.Context, name string) (int64, error) {
+	var id int64
+	err := s.queryRow(ctx, `SELECT id FROM modules WHERE name = ?
+		UNION ALL SELECT module_id FROM module_aliases WHERE name = ?`, name, name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m, err := s.AddModule(ctx, name)
+		return m.ID, err
+	}
+	return id, err
+}
+
+// The module_name of a grade is its module's name, which the dashboard shows.
+func (s *sqlStore) InsertGrade(ctx context.Context, g storedGrade) error {
+	id, err := s.moduleID(ctx, g.Module)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, `INSERT INTO grades_v2 (account, module_id, module_name, grade, occurrence_index, status, updated_at)
+		VALUES (?, ?, (SELECT name FROM modules WHERE id = ?), ?, ?, ?, ?)`,
+		g.Account, id, id, sealValue(g.Grade), g.OccurrenceIndex, g.Status, g.UpdatedAt)
+	return err
+}
+
+func (s *sqlStore) UpdateGrade(ctx context.Context, g storedGrade) error {
+	id, err := s.moduleID(ctx, g.Module)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, "UPDATE grades_v2 SET grade = ?, status = ?, updated_at = ? WHERE account = ? AND module_id = ? AND occurrence_index = ?",
+		sealValue(g.Grade), g.Status, g.UpdatedAt, g.Account, id, g.OccurrenceIndex)
+	return err
+}
+
+const eventColumns = `e.account, e.type, m.name, e.module_name, e.occurrence_index, e.grade, e.previous_grade, e.silent, e.created_at`
+
+// The module_name of an event is the name of its module when it was
+// recorded (kept when an event is added again, e.g. by import); the
+// events are returned with the current name.
+func (s *sqlStore) AddEvent(ctx context.Context, e GradeEvent) error {
+	id, err := s.moduleID(ctx, e.Module)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, `INSERT INTO grade_events (account, type, module_id, module_name, occurrence_index, grade, previous_grade, silent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Account, e.Type, id, cmp.Or(e.RecordedModule, e.Module), e.OccurrenceIndex, sealValue(e.Grade), sealValue(e.PreviousGrade), e.Silent, e.Time)
+	return err
+}
+
+func (s *sqlStore) Events(ctx context.Context, account, module string, occurrence int) ([]GradeEvent, error) {
+	return s.events(ctx, `SELECT `+eventColumns+` FROM grade_events e JOIN modules m ON m.id = e.module_id
+		WHERE e.account = ? AND m.name = ? AND e.occurrence_index = ? ORDER BY e.id`, account, module, occurrence)
+}
+
+func (s *sqlStore) AccountEvents(ctx context.Context, account string) ([]GradeEvent, error) {
+	return s.events(ctx, `SELECT `+eventColumns+` FROM grade_events e JOIN modules m ON m.id = e.module_id
+		WHERE CAST(? AS TEXT) = '' OR e.account = ? ORDER BY e.id`, account, account)
+}
+
+// events reads grade_events rows selected with eventColumns.
+func (s *sqlStore) events(ctx context.Context, query string, args ...any) ([]GradeEvent, error) {
+	rows, err := s.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []GradeEvent{}
+	for rows.Next() {
+		var e GradeEvent
+		if err := rows.Scan(&e.Account, &e.Type, &e.Module, &e.RecordedModule, &e.OccurrenceIndex, &e.Grade, &e.PreviousGrade, &e.Silent, &e.Time); err != nil {
+			return nil, err
+		}
+		if e.Grade, err = openValue(e.Grade); err != nil {
+			return nil, err
+		}
+		if e.PreviousGrade, err = openValue(e.PreviousGrade); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *sqlStore) ReplaceEvents(ctx context.Context, account string, events []GradeEvent) error {
+	return s.Tx(ctx, func(tx Store) error {
+		if _, err := tx.(*sqlStore).exec(ctx, "DELETE FROM grade_events WHERE account = ?", account); err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := tx.AddEvent(ctx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStore) EventCounts(ctx context.Context) (map[string]int, error) {
+	rows, err := s.query(ctx, "SELECT type, COUNT(*) FROM grade_events GROUP BY type")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var typ string
+		var n int
+		if err := rows.Scan(&typ, &n); err != nil {
+			return nil, err
+		}
+		counts[typ] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *sqlStore) Modules(ctx context.Context) ([]Module, error) {
+	return s.modules(ctx, 0)
+}
+
+func (s *sqlStore) Module(ctx context.Context, id int64) (Module, error) {
+	modules, err := s.modules(ctx, id)
+	if err != nil {
+		return Module{}, err
+	}
+	if len(modules) == 0 {
+		return Module{}, errNotFound
+	}
+	return modules[0], nil
+}
+
+// modules reads the module with an ID, or all modules for 0.
+func (s *sqlStore) modules(ctx context.Context, id int64) ([]Module, error) {
+	rows, err := s.query(ctx, `SELECT id, name, COALESCE(credits, 0), COALESCE(semester, 0) FROM modules
+		WHERE ? = 0 OR id = ? ORDER BY name`, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	modules := []Module{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		m := Module{Aliases: []string{}}
+		if err := rows.Scan(&m.ID, &m.Name, &m.Credits, &m.Semester); err != nil {
+			return nil, err
+		}
+		index[m.ID] = len(modules)
+		modules = append(modules, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = s.query(ctx, "SELECT module_id, name FROM module_aliases WHERE ? = 0 OR module_id = ? ORDER BY id", id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var moduleID int64
+		var name string
+		if err := rows.Scan(&moduleID, &name); err != nil {
+			return nil, err
+		}
+		if i, ok := index[moduleID]; ok {
+			modules[i].Aliases = append(modules[i].Aliases, name)
+		}
+	}
+	return modules, rows.Err()
+}
+
+func (s *sqlStore) AddModule(ctx context.Context, name string) (Module, error) {
+	m := Module{Name: name, Aliases: []string{}}
+	err := s.queryRow(ctx, "INSERT INTO modules (name) VALUES (?) RETURNING id", name).Scan(&m.ID)
+	return m, err
+}
+
+func (s *sqlStore) AddAlias(ctx context.Context, id int64, name string) error {
+	_, err := s.exec(ctx, "INSERT INTO module_aliases (module_id, name) VALUES (?, ?)", id, name)
+	return err
+}
+
+func (s *sqlStore) UpdateModule(ctx context.Context, m Module) error {
+	return s.Tx(ctx, func(tx Store) error {
+		s := tx.(*sqlStore)
+		old, err := s.Module(ctx, m.ID)
+		if err != nil {
+			return err
+		}
+		// 0 is stored as NULL, which is unknown
+		var credits, semester any
+		if m.Credits != 0 {
+			credits = m.Credits
+		}
+		if m.Semester != 0 {
+			semester = m.Semester
+		}
+		if old.Name != m.Name {
+			var other int64
+			err := s.queryRow(ctx, `SELECT id FROM modules WHERE name = ? AND id != ?
+				UNION ALL SELECT module_id FROM module_aliases WHERE name = ? AND module_id != ?`, m.Name, m.ID, m.Name, m.ID).Scan(&other)
+			if err == nil {
+				return fmt.Errorf("%q is a name of module %d; merge the modules instead", m.Name, other)
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if _, err := s.exec(ctx, "DELETE FROM module_aliases WHERE module_id = ? AND name = ?", m.ID, m.Name); err != nil {
+				return err
+			}
+		}
+		if _, err := s.exec(ctx, "UPDATE modules SET name = ?, credits = ?, semester = ? WHERE id = ?",
+			m.Name, credits, semester, m.ID); err != nil {
+			return err
+		}
+		if old.Name == m.Name {
+			return nil
+		}
+		if err := s.AddAlias(ctx, m.ID, old.Name); err != nil {
+			return err
+		}
+		_, err = s.exec(ctx, "UPDATE grades_v2 SET module_name = ? WHERE module_id = ?", m.Name, m.ID)
+		return err
+	})
+}
+
+func (s *sqlStore) MergeModules(ctx context.Context, into, from int64) error {
+	return s.Tx(ctx, func(tx Store) error {
+		s := tx.(*sqlStore)
+		target, err := s.Module(ctx, into)
+		if err != nil {
+			return err
+		}
+		source, err := s.Module(ctx, from)
+		if err != nil {
+			return err
+		}
+
+		// Of two grades of the same account and attempt, keep one
+		type row struct {
+			id                int64
+			status, updatedAt string
+		}
+		type key struct {
+			account    string
+			occurrence int
+		}
+		rows, err := s.query(ctx, `SELECT id, module_id, account, occurrence_index, COALESCE(status, ''), COALESCE(updated_at, '')
+			FROM grades_v2 WHERE module_id = ? OR module_id = ?`, into, from)
+		if err != nil {
+			return err
+		}
+		grades := map[int64]map[key]row{into: {}, from: {}}
+		for rows.Next() {
+			var r row
+			var k key
+			var moduleID int64
+			if err := rows.Scan(&r.id, &moduleID, &k.account, &k.occurrence, &r.status, &r.updatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			grades[moduleID][k] = r
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for k, b := range grades[from] {
+			a, ok := grades[into][k]
+			if !ok {
+				continue
+			}
+			drop := b.id
+			switch {
+			case a.status != eventRemoved && b.status != eventRemoved:
+				return fmt.Errorf("%w: %q and %q, attempt %d of account %s", errModuleConflict, target.Name, source.Name, k.occurrence+1, k.account)
+			case a.status == eventRemoved && b.status != eventRemoved,
+				a.status == b.status && a.updatedAt < b.updatedAt:
+				drop = a.id
+			}
+			if _, err := s.exec(ctx, "DELETE FROM grades_v2 WHERE id = ?", drop); err != nil {
+				return err
+			}
+		}
+
+		if _, err := s.exec(ctx, "UPDATE grades_v2 SET module_id = ?, module_name = ? WHERE module_id = ?", into, target.Name, from); err != nil {
+			return err
+		}
+		if _, err := s.exec(ctx, "UPDATE grade_events SET module_id = ? WHERE module_id = ?", into, from); err != nil {
+			return err
+		}
+		if _, err := s.exec(ctx, "UPDATE module_aliases SET module_id = ? WHERE module_id = ?", into, from); err != nil {
+			return err
+		}
+		if _, err := s.exec(ctx, `UPDATE modules SET
+			credits = COALESCE(credits, (SELECT credits FROM modules WHERE id = ?)),
+			semester = COALESCE(semester, (SELECT semester FROM modules WHERE id = ?))
+			WHERE id = ?`, from, from, into); err != nil {
+			return err
+		}
+		if _, err := s.exec(ctx, "DELETE FROM modules WHERE id = ?", from); err != nil {
+			return err
+		}
+		return s.AddAlias(ctx, into, source.Name)
+	})
+}
+
+func (s *sqlStore) Status(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.queryRow(ctx, "SELECT COALESCE(value, '') FROM system_status WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+func (s *sqlStore) Statuses(ctx context.Context) (map[string]string, error) {
+	rows, err := s.query(ctx, "SELECT key, COALESCE(value, '') FROM system_status")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	status := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		status[k] = v
+	}
+	return status, rows.Err()
+}
+
+func (s *sqlStore) SetStatus(ctx context.Context, key, value string) error {
+	_, err := s.exec(ctx, `INSERT INTO system_status (key, value, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=excluded.updated_at`,
+		key, value, now())
+	return err
+}
+
+func (s *sqlStore) DeleteStatus(ctx context.Context, key string) (bool, error) {
+	res, err := s.exec(ctx, "DELETE FROM system_status WHERE key = ?", key)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// The lease times are UTC so they compare correctly as text.
+func (s *sqlStore) AcquireLease(ctx context.Context, holder string, at time.Time) error {
+	res, err := s.exec(ctx, `INSERT INTO system_status (key, value, updated_at) VALUES ('leader', ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+		WHERE system_status.value = excluded.value OR system_status.updated_at < ?`,
+		holder, at.UTC().Format(time.RFC3339), at.Add(-leaseDuration).UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("taking database lease: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	var other, since string
+	s.queryRow(ctx, "SELECT value, updated_at FROM system_status WHERE key = 'leader'").Scan(&other, &since)
+	age := "recently"
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		age = at.Sub(t).Round(time.Second).String() + " ago"
+	}
+	return fmt.Errorf("%w: the database is in use by %s (last seen %s)", errLocked, other, age)
+}
+
+func (s *sqlStore) ReleaseLease(ctx context.Context, holder string) error {
+	_, err := s.exec(ctx, "DELETE FROM system_status WHERE key = 'leader' AND value = ?", holder)
+	return err
+}
+
+func (s *sqlStore) Enqueue(ctx context.Context, account, backend, message string) error {
+	_, err := s.exec(ctx, "INSERT INTO outbox (account, backend, message, created_at) VALUES (?, ?, ?, ?)",
+		account, backend, sealValue(message), now())
+	return err
+}
+
+func (s *sqlStore) DueNotifications(ctx context.Context) ([]outboxEntry, error) {
+	rows, err := s.query(ctx, `SELECT id, account, backend, message, attempts FROM outbox
+		WHERE sent_at IS NULL AND attempts < ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)
+		ORDER BY id`, maxOutboxAttempts, utcNow())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var due []outboxEntry
+	for rows.Next() {
+		var e outboxEntry
+		if err := rows.Scan(&e.ID, &e.Account, &e.Backend, &e.Message, &e.Attempts); err != nil {
+			return nil, err
+		}
+		if e.Message, err = openValue(e.Message); err != nil {
+			return nil, err
+		}
+		due = append(due, e)
+	}
+	return due, rows.Err()
+}
+
+func (s *sqlStore) MarkSent(ctx context.Context, id int64) error {
+	_, err := s.exec(ctx, "UPDATE outbox SET sent_at = ?, attempts = attempts + 1, last_error = NULL WHERE id = ?", now(), id)
+	return err
+}
+
+// next_attempt_at is UTC (see utcNow).
+func (s *sqlStore) MarkFailed(ctx context.Context, id int64, reason string, retry time.Time) error {
+	_, err := s.exec(ctx, "UPDATE outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		reason, retry.UTC().Format(time.RFC3339), id)
+	return err
+}
+
+func (s *sqlStore) PurgeOutbox(ctx context.Context, before time.Time) error {
+	_, err := s.exec(ctx, "DELETE FROM outbox WHERE sent_at IS NOT NULL AND created_at < ?", before.Format(time.RFC3339))
+	return err
+}
+
+func (s *sqlStore) OutboxCounts(ctx context.Context) (pending, failed int, err error) {
+	err = s.queryRow(ctx, `SELECT
+		COUNT(CASE WHEN attempts < ? THEN 1 END),
+		COUNT(CASE WHEN attempts >= ? THEN 1 END)
+		FROM outbox WHERE sent_at IS NULL`, maxOutboxAttempts, maxOutboxAttempts).Scan(&pending, &failed)
+	return pending, failed, err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	_ "modernc.org/sqlite"
+)
+
+var sqliteDialect = &dialect{
+	backend: "sqlite",
+	version: func(ctx context.Context, db *sql.DB) (version int, err error) {
+		err = db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+		return version, err
+	},
+	migrate: func(_ context.Context, db *sql.DB) error {
+		return migrate(db)
+	},
+	compact: func(ctx context.Context, db *sql.DB) error {
+		if _, err := db.ExecContext(ctx, "VACUUM"); err != nil {
+			return err
+		}
+		// VACUUM writes through the WAL; move it into the file and empty it
+		_, err := db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)")
+		return err
+	},
+}
+
+// sqlitePragmas are set on every connection of the pool. In WAL mode the
+// API, the event stream and the lease renewal can read while a check
+// commits; the busy timeout makes a writer wait for another one instead
+// of failing with SQLITE_BUSY. secure_delete overwrites deleted rows, so
+// purged notifications and replaced grades do not stay in free space.
+const sqlitePragmas = "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=secure_delete(ON)"
+
+// openSQLite opens a SQLite database file, which is created on the first
+// write if it does not exist.
+func openSQLite(path string) (*sqlStore, error) {
+	db, err := sql.Open("sqlite", path+sqlitePragmas)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{db: db, dialect: sqliteDialect, name: path}, nil
+}
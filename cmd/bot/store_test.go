@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// forEachStore runs test against a migrated SQLite database and, if
+// TEST_POSTGRES_DSN is set to a postgres:// URL (see make test-postgres),
+// against PostgreSQL in a schema of its own that is dropped afterwards.
+func forEachStore(t *testing.T, test func(t *testing.T, db Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := openSQLite(filepath.Join(t.TempDir(), "grades.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := db.Migrate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		test(t, db)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("TEST_POSTGRES_DSN is not set")
+		}
+		admin, err := sql.Open("pgx", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 6)
+		rand.Read(b)
+		schema := "test_" + hex.EncodeToString(b)
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			admin.Close()
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+			admin.Close()
+		})
+
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		db, err := openPostgres(u.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := db.Migrate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		test(t, db)
+	})
+}
+
+func TestStoreSchema(t *testing.T) {
+	if len(postgresMigrations) != len(migrations) {
+		t.Fatalf("%d PostgreSQL migrations, %d SQLite ones", len(postgresMigrations), len(migrations))
+	}
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		if err := db.Migrate(ctx); err != nil {
+			t.Fatalf("migrating twice: %v", err)
+		}
+		if version, err := db.SchemaVersion(ctx); err != nil || version != schemaVersion {
+			t.Errorf("schema version %d, %v, want %d", version, err, schemaVersion)
+		}
+	})
+}
+
+func TestStoreGrades(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		for _, g := range []storedGrade{
+			{Account: "default", Module: "Mathematik II", Grade: "2,0", Status: eventNew, UpdatedAt: "2026-07-02T10:00:00Z"},
+			{Account: "default", Module: "Mathematik I", Grade: "5,0", Status: eventNew, UpdatedAt: "2026-07-01T10:00:00Z"},
+			{Account: "default", Module: "Mathematik I", Grade: "1,7", OccurrenceIndex: 1, Status: eventNew, UpdatedAt: "2026-07-01T10:00:00Z"},
+			{Account: "bob", Module: "Recht", Grade: "#", Status: eventNew, UpdatedAt: "2026-07-01T10:00:00Z"},
+		} {
+			if err := db.InsertGrade(ctx, g); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		grades, err := db.Grades(ctx, "default", "mathematik i")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(grades) != 3 || grades[0].Module != "Mathematik I" || grades[1].OccurrenceIndex != 1 || grades[2].Module != "Mathematik II" {
+			t.Errorf("grades = %+v", grades)
+		}
+		if all, err := db.Grades(ctx, "", ""); err != nil || len(all) != 4 || all[0].Account != "bob" {
+			t.Errorf("all grades = %+v, %v", all, err)
+		}
+		for _, filter := range []string{"_", "%", `\`, "mathematik_i"} {
+			if found, err := db.Grades(ctx, "", filter); err != nil || len(found) != 0 {
+				t.Errorf("grades matching %q = %+v, %v", filter, found, err)
+			}
+		}
+
+		g := grades[0]
+		g.Grade, g.Status = "4,0", eventRemoved
+		if err := db.UpdateGrade(ctx, g); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := db.Grade(ctx, g.ID); err != nil || got != g {
+			t.Errorf("Grade(%d) = %+v, %v, want %+v", g.ID, got, err, g)
+		}
+		if _, err := db.Grade(ctx, 1000); !errors.Is(err, errNotFound) {
+			t.Errorf("missing grade: %v", err)
+		}
+	})
+}
+
+func TestStoreCommitWithOpenReader(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		if err := db.InsertGrade(ctx, storedGrade{Account: "default", Module: "Mathematik I", Grade: "1,7", Status: eventNew}); err != nil {
+			t.Fatal(err)
+		}
+		// A reader on another connection of the pool, like the API while a
+		// check commits
+		rows, err := db.(*sqlStore).query(ctx, "SELECT module_name FROM grades_v2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			t.Fatal("no grade read")
+		}
+
+		err = db.Tx(ctx, func(tx Store) error {
+			if err := tx.InsertGrade(ctx, storedGrade{Account: "default", Module: "Recht", Grade: "2,0", Status: eventNew}); err != nil {
+				return err
+			}
+			return tx.Enqueue(ctx, "default", "fake", "New Grade: Recht - 2,0")
+		})
+		if err != nil {
+			t.Fatalf("commit with an open reader: %v", err)
+		}
+	})
+}
+
+func TestStoreEvents(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		for _, e := range []GradeEvent{
+			{Account: "default", Type: eventNew, Module: "Mathematik I", Grade: "#", Silent: true, Time: "2026-07-01T10:00:00Z"},
+			{Account: "bob", Type: eventNew, Module: "Recht", Grade: "2,3", Time: "2026-07-02T10:00:00Z"},
+			{Account: "default", Type: eventChanged, Module: "Mathematik I", Grade: "1,7", PreviousGrade: "#", Time: "2026-07-03T10:00:00Z"},
+		} {
+			if err := db.AddEvent(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		events, err := db.Events(ctx, "default", "Mathematik I", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || !events[0].Silent || events[1].PreviousGrade != "#" {
+			t.Errorf("events = %+v", events)
+		}
+		if all, err := db.AccountEvents(ctx, ""); err != nil || len(all) != 3 || all[1].Account != "bob" {
+			t.Errorf("all events = %+v, %v", all, err)
+		}
+
+		replaced := []GradeEvent{{Account: "default", Type: eventNew, Module: "Analysis", Grade: "1,0", Time: "2026-06-01T10:00:00Z", RecordedModule: "Analysis"}}
+		if err := db.ReplaceEvents(ctx, "default", replaced); err != nil {
+			t.Fatal(err)
+		}
+		if events, err := db.AccountEvents(ctx, "default"); err != nil || len(events) != 1 || events[0] != replaced[0] {
+			t.Errorf("replaced events = %+v, %v", events, err)
+		}
+		if counts, err := db.EventCounts(ctx); err != nil || counts[eventNew] != 2 || counts[eventChanged] != 0 {
+			t.Errorf("counts = %v, %v", counts, err)
+		}
+	})
+}
+
+func TestStoreStatusAndLease(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		if v, err := db.Status(ctx, "last_check"); err != nil || v != "" {
+			t.Errorf("unset status = %q, %v", v, err)
+		}
+		for _, value := range []string{"a", "b"} {
+			if err := db.SetStatus(ctx, "last_check", value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if all, err := db.Statuses(ctx); err != nil || len(all) != 1 || all["last_check"] != "b" {
+			t.Errorf("statuses = %v, %v", all, err)
+		}
+		if deleted, err := db.DeleteStatus(ctx, "last_check"); err != nil || !deleted {
+			t.Errorf("DeleteStatus = %v, %v", deleted, err)
+		}
+		if deleted, _ := db.DeleteStatus(ctx, "last_check"); deleted {
+			t.Error("deleted a missing key")
+		}
+
+		start := time.Now()
+		if err := db.AcquireLease(ctx, "a", start); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AcquireLease(ctx, "b", start.Add(time.Minute)); !errors.Is(err, errLocked) {
+			t.Errorf("second holder got %v, want errLocked", err)
+		}
+		if err := db.ReleaseLease(ctx, "b"); err != nil {
+			t.Fatal(err)
+		}
+		if holder, _ := db.Status(ctx, "leader"); holder != "a" {
+			t.Errorf("another holder released the lease of %q", holder)
+		}
+		if err := db.ReleaseLease(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AcquireLease(ctx, "b", start.Add(time.Minute)); err != nil {
+			t.Errorf("taking a released lease: %v", err)
+		}
+	})
+}
+
+func TestStoreOutbox(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		for _, msg := range []string{"first", "second"} {
+			if err := db.Enqueue(ctx, "default", "fake", msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		due, err := db.DueNotifications(ctx)
+		if err != nil || len(due) != 2 || due[0].Message != "first" {
+			t.Fatalf("due = %+v, %v", due, err)
+		}
+		if err := db.MarkSent(ctx, due[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.MarkFailed(ctx, due[1].ID, "offline", time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if due, err := db.DueNotifications(ctx); err != nil || len(due) != 0 {
+			t.Errorf("due after a failed attempt = %+v, %v", due, err)
+		}
+		if pending, failed, err := db.OutboxCounts(ctx); err != nil || pending != 1 || failed != 0 {
+			t.Errorf("counts = %d, %d, %v", pending, failed, err)
+		}
+
+		if err := db.PurgeOutbox(ctx, time.Now().Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		var left int
+		if err := db.(*sqlStore).queryRow(ctx, "SELECT COUNT(*) FROM outbox").Scan(&left); err != nil || left != 1 {
+			t.Errorf("%d notifications left after the purge, want the undelivered one (%v)", left, err)
+		}
+	})
+}
+
+func TestStoreTx(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		errAbort := errors.New("abort")
+		err := db.Tx(ctx, func(tx Store) error {
+			if err := tx.SetStatus(ctx, "rolled_back", "1"); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("Tx = %v", err)
+		}
+		err = db.Tx(ctx, func(tx Store) error {
+			// A nested Tx joins the transaction
+			return tx.Tx(ctx, func(tx Store) error {
+				return tx.SetStatus(ctx, "committed", "1")
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if all, err := db.Statuses(ctx); err != nil || len(all) != 1 || all["committed"] != "1" {
+			t.Errorf("statuses = %v, %v", all, err)
+		}
+	})
+}
+
+func TestStoreReseal(t *testing.T) {
+	forEachStore(t, func(t *testing.T, db Store) {
+		ctx := context.Background()
+		if err := db.InsertGrade(ctx, storedGrade{Account: "default", Module: "Recht", Grade: "2,3", Status: eventNew}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddEvent(ctx, GradeEvent{Account: "default", Type: eventNew, Module: "Recht", Grade: "2,3", Time: now()}); err != nil {
+			t.Fatal(err)
+		}
+		n, err := db.Reseal(ctx, func(v string) (string, error) { return v + "!", nil })
+		if err != nil || n != 2 {
+			t.Fatalf("Reseal = %d, %v, want 2 values (empty ones are skipped)", n, err)
+		}
+		if grades, err := db.Grades(ctx, "", ""); err != nil || grades[0].Grade != "2,3!" {
+			t.Errorf("grades = %+v, %v", grades, err)
+		}
+
+		_, err = db.Reseal(ctx, func(v string) (string, error) { return "", errors.New("wrong key") })
+		if err == nil {
+			t.Fatal("Reseal ignored an error")
+		}
+		if grades, _ := db.Grades(ctx, "", ""); grades[0].Grade != "2,3!" {
+			t.Errorf("a failed Reseal changed the grade to %q", grades[0].Grade)
+		}
+	})
+}
@@ -0,0 +1,357 @@
+// Package config loads the bot configuration from a YAML or TOML file and
+// the environment, and validates it.
+//
+// The environment variables of earlier versions (.env) keep working: they
+// override the values from the file, so a file is optional.
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultAccount is the account of the classic single-user setup.
+const DefaultAccount = "default"
+
+// Files are the configuration files looked for in the working directory,
+// in this order, if CONFIG_FILE is not set.
+var Files = []string{"gradechecker.yaml", "gradechecker.yml", "gradechecker.toml"}
+
+// Config is the complete bot configuration.
+type Config struct {
+	Check      Check      `yaml:"check" toml:"check"`
+	API        API        `yaml:"api" toml:"api"`
+	Log        Log        `yaml:"log" toml:"log"`
+	Notify     Notify     `yaml:"notify" toml:"notify"`
+	Database   Database   `yaml:"database" toml:"database"`
+	Encryption Encryption `yaml:"encryption" toml:"encryption"`
+	Accounts   []Account  `yaml:"accounts" toml:"accounts"`
+
+	// Path is the file the configuration was read from, empty if none.
+	Path string `yaml:"-" toml:"-"`
+	// sources maps field paths to where their values were set.
+	sources map[string]string
+	// warnings lists the values that are used, but likely not as meant.
+	warnings Errors
+}
+
+// Check configures when the grades are checked.
+type Check struct {
+	// Interval between checks, used if Schedule is empty.
+	Interval Duration `yaml:"interval" toml:"interval"`
+	// Schedule is a cron expression or "@every <duration>".
+	Schedule  string     `yaml:"schedule" toml:"schedule"`
+	Overrides []Override `yaml:"overrides" toml:"overrides"`
+	// Jitter is the maximum random delay added to every run.
+	Jitter Duration `yaml:"jitter" toml:"jitter"`
+}
+
+// Override replaces the schedule between two dates (both inclusive,
+// formatted as 2006-01-02).
+type Override struct {
+	From     string `yaml:"from" toml:"from"`
+	To       string `yaml:"to" toml:"to"`
+	Schedule string `yaml:"schedule" toml:"schedule"`
+}
+
+// API configures the HTTP API.
+type API struct {
+	// Addr is the listen address, "off" disables the API.
+	Addr  string `yaml:"addr" toml:"addr"`
+	Token string `yaml:"token" toml:"token" secret:"true"`
+}
+
+// Log configures the log output.
+type Log struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+	File   string `yaml:"file" toml:"file"`
+	// MaxSize is the size in megabytes after which the file is rotated.
+	MaxSize    int `yaml:"max_size" toml:"max_size"`
+	MaxBackups int `yaml:"max_backups" toml:"max_backups"`
+}
+
+// Notify configures the notification backends. The settings of an account
+// fall back to the global ones.
+type Notify struct {
+	Discord Discord `yaml:"discord" toml:"discord"`
+}
+
+// Discord configures Discord notifications.
+type Discord struct {
+	Enabled *bool `yaml:"enabled" toml:"enabled"`
+	// Mode is "webhook" (default) or "dm".
+	Mode       string `yaml:"mode" toml:"mode"`
+	BotToken   string `yaml:"bot_token" toml:"bot_token" secret:"true"`
+	UserID     string `yaml:"user_id" toml:"user_id"`
+	WebhookURL string `yaml:"webhook_url" toml:"webhook_url" secret:"true"`
+}
+
+// Database selects where the grades are stored.
+type Database struct {
+	// URL is a postgres:// connection URL; empty keeps them in grades.db.
+	URL string `yaml:"url" toml:"url" secret:"true"`
+}
+
+// Encryption configures the at-rest encryption of the database and the
+// transcripts. At most one of the two may be set; none disables it.
+type Encryption struct {
+	Passphrase string `yaml:"passphrase" toml:"passphrase" secret:"true"`
+	KeyFile    string `yaml:"key_file" toml:"key_file"`
+}
+
+// Enabled reports whether a key is configured.
+func (e Encryption) Enabled() bool {
+	return e.Passphrase != "" || e.KeyFile != ""
+}
+
+// Account is a CIS user monitored by the bot.
+type Account struct {
+	Name          string `yaml:"name" toml:"name"`
+	Username      string `yaml:"username" toml:"username"`
+	Password      string `yaml:"password" toml:"password" secret:"true"`
+	TranscriptURL string `yaml:"transcript_url" toml:"transcript_url"`
+	ResultsURL    string `yaml:"results_url" toml:"results_url"`
+	// Source is "pdf" (default), "html" or "both".
+	Source string `yaml:"source" toml:"source"`
+	Notify Notify `yaml:"notify" toml:"notify"`
+}
+
+// Duration is a time.Duration written as "90s", "10m" or "1h30m".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if _, err := strconv.Atoi(s); err == nil {
+		return fmt.Errorf("%q needs a unit, e.g. \"%sm\"", s, s)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration like \"10m\" or \"1h30m\"", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalYAML adds the line to errors, which yaml.v3 does not do for
+// UnmarshalText.
+func (d *Duration) UnmarshalYAML(n *yaml.Node) error {
+	if err := d.UnmarshalText([]byte(n.Value)); err != nil {
+		return fmt.Errorf("line %d: %w", n.Line, err)
+	}
+	return nil
+}
+
+// Default returns the configuration used for unset values.
+func Default() *Config {
+	return &Config{
+		Check:   Check{Interval: Duration(time.Hour)},
+		API:     API{Addr: "127.0.0.1:4322"},
+		Log:     Log{Level: "info", Format: "text", MaxSize: 10, MaxBackups: 5},
+		sources: make(map[string]string),
+	}
+}
+
+// Find returns the configuration file to use: CONFIG_FILE, or the first of
+// Files that exists, or "" if there is none.
+func Find(getenv func(string) string) string {
+	if path := getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	for _, name := range Files {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// Load reads the configuration file at path (none if empty), applies the
+// environment variables from getenv and validates the result. Invalid
+// values are reported as Errors; the returned configuration is then only
+// good for showing what was read.
+func Load(path string, getenv func(string) string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	errs := c.applyEnv(getenv)
+	errs = append(errs, c.validate()...)
+	if len(errs) > 0 {
+		return c, errs
+	}
+	return c, nil
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	c.Path = path
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		yamlSources(&root, "", path, c.sources)
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return fmt.Errorf("%s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+		// TOML keys carry no line numbers, so values are attributed to the file
+		for _, k := range md.Keys() {
+			c.sources[strings.Join(k, ".")] = path
+		}
+	default:
+		return fmt.Errorf("%s: unknown file type %q (expected .yaml, .yml or .toml)", path, ext)
+	}
+	return nil
+}
+
+// yamlSources records the line of every value in the document.
+func yamlSources(n *yaml.Node, prefix, path string, sources map[string]string) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, child := range n.Content {
+			yamlSources(child, prefix, path, sources)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			sources[key] = fmt.Sprintf("%s:%d", path, n.Content[i].Line)
+			yamlSources(n.Content[i+1], key, path, sources)
+		}
+	case yaml.SequenceNode:
+		for i, child := range n.Content {
+			key := fmt.Sprintf("%s[%d]", prefix, i)
+			sources[key] = fmt.Sprintf("%s:%d", path, child.Line)
+			yamlSources(child, key, path, sources)
+		}
+	}
+}
+
+// Source returns where the value of a field was set: "FILE:LINE" (or just
+// the file for TOML), "env NAME", or "" for defaults. Without its own
+// entry, a field is attributed to the closest parent that has one.
+func (c *Config) Source(field string) string {
+	for f := field; f != ""; {
+		if s, ok := c.sources[f]; ok {
+			return s
+		}
+		i := strings.LastIndexAny(f, ".[")
+		if i < 0 {
+			break
+		}
+		f = f[:i]
+	}
+	return ""
+}
+
+// Warnings lists the values that are valid but likely not meant as they
+// are read, like a secret that looks like a malformed reference.
+func (c *Config) Warnings() Errors {
+	return c.warnings
+}
+
+// Invalid returns an error for a field, attributed to where it was set.
+func (c *Config) Invalid(field, format string, args ...any) *FieldError {
+	return &FieldError{Field: field, Source: c.Source(field), Msg: fmt.Sprintf(format, args...)}
+}
+
+// FieldError is an invalid configuration value.
+type FieldError struct {
+	// Field is the path of the value, e.g. "check.interval" or
+	// "accounts[1].source".
+	Field string
+	// Source is where the value was set, see Config.Source.
+	Source string
+	Msg    string
+}
+
+func (e *FieldError) Error() string {
+	if e.Source == "" {
+		return e.Field + ": " + e.Msg
+	}
+	return e.Source + ": " + e.Field + ": " + e.Msg
+}
+
+// Errors lists all problems of a configuration.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// AccountNotify returns the notification settings of an account, with
+// unset values taken from the global settings.
+func (c *Config) AccountNotify(a Account) Discord {
+	d, g := a.Notify.Discord, c.Notify.Discord
+	if d.Enabled == nil {
+		d.Enabled = g.Enabled
+	}
+	d.Mode = cmp.Or(d.Mode, g.Mode)
+	d.BotToken = cmp.Or(d.BotToken, g.BotToken)
+	d.UserID = cmp.Or(d.UserID, g.UserID)
+	d.WebhookURL = cmp.Or(d.WebhookURL, g.WebhookURL)
+	return d
+}
+
+// IsEnabled reports whether Discord notifications are switched on.
+func (d Discord) IsEnabled() bool {
+	return d.Enabled != nil && *d.Enabled
+}
+
+// EnvSuffix turns an account name into an environment variable suffix,
+// e.g. "alice" into "ALICE" for CIS_USERNAME_ALICE.
+func EnvSuffix(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
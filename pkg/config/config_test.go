@@ -0,0 +1,284 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := writeFile(t, "gradechecker.yaml", `check:
+  interval: 30m
+  overrides:
+    - from: 2026-07-01
+      to: 2026-07-20
+      schedule: "*/5 * * * *"
+notify:
+  discord:
+    enabled: true
+    webhook_url: https://discord.com/api/webhooks/1/abc
+accounts:
+  - name: alice
+    username: alice
+    source: html
+  - name: bob
+    notify:
+      discord:
+        enabled: false
+`)
+	c, err := Load(path, env(map[string]string{"CIS_PASSWORD_ALICE": "hunter2", "CHECK_JITTER": "2"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Check.Interval != Duration(30*time.Minute) || c.Check.Jitter != Duration(2*time.Minute) {
+		t.Errorf("interval %v, jitter %v", c.Check.Interval, c.Check.Jitter)
+	}
+	if len(c.Accounts) != 2 || c.Accounts[0].Password != "hunter2" || c.Accounts[0].Source != "html" {
+		t.Errorf("accounts = %+v", c.Accounts)
+	}
+	if !c.AccountNotify(c.Accounts[0]).IsEnabled() || c.AccountNotify(c.Accounts[1]).IsEnabled() {
+		t.Error("account notification settings should fall back to the global ones")
+	}
+	if got := c.Source("accounts[0].source"); got != path+":14" {
+		t.Errorf("source of accounts[0].source = %q", got)
+	}
+	if got := c.Source("accounts[0].password"); got != "env CIS_PASSWORD_ALICE" {
+		t.Errorf("source of accounts[0].password = %q", got)
+	}
+	if got := c.Secrets(); !slices.Contains(got, "hunter2") || len(got) != 2 {
+		t.Errorf("secrets = %q", got)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "gradechecker.toml", `[api]
+addr = "off"
+
+[[accounts]]
+name = "alice"
+`)
+	c, err := Load(path, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.API.Addr != "off" || len(c.Accounts) != 1 || c.Accounts[0].Name != "alice" {
+		t.Errorf("config = %+v", c)
+	}
+
+	path = writeFile(t, "gradechecker.toml", "[check]\ninterval = 60\n")
+	if _, err := Load(path, env(nil)); err == nil || !strings.Contains(err.Error(), `needs a unit, e.g. "60m"`) {
+		t.Errorf("interval without unit: %v", err)
+	}
+	path = writeFile(t, "gradechecker.toml", "[api]\nadress = \"off\"\n")
+	if _, err := Load(path, env(nil)); err == nil || !strings.Contains(err.Error(), "api.adress") {
+		t.Errorf("unknown key: %v", err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := writeFile(t, "gradechecker.yaml", "check:\n  interval: 60\n")
+	if _, err := Load(path, env(nil)); err == nil || !strings.Contains(err.Error(), `line 2: "60" needs a unit`) {
+		t.Errorf("interval without unit: %v", err)
+	}
+	path = writeFile(t, "gradechecker.yaml", "log:\n  levle: debug\n")
+	if _, err := Load(path, env(nil)); err == nil || !strings.Contains(err.Error(), "field levle not found") {
+		t.Errorf("unknown key: %v", err)
+	}
+
+	path = writeFile(t, "gradechecker.yaml", `log:
+  level: verbose
+accounts:
+  - name: alice
+    source: pdf
+  - name: Alice
+    source: scrape
+`)
+	_, err := Load(path, env(map[string]string{"API_ADDR": "4322", "DATABASE_URL": "mysql://bot:hunter2@db/grades"}))
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+	want := []string{
+		path + `:2: log.level: "verbose" is not one of ["debug" "info" "warn" "error"]`,
+		`env API_ADDR: api.addr: "4322" is not HOST:PORT or "off"`,
+		`env DATABASE_URL: database.url: is not a postgres:// URL; leave it empty to use grades.db`,
+		path + `:6: accounts[1].name: "Alice" clashes with account "alice" (both use the suffix _ALICE)`,
+		path + `:7: accounts[1].source: "scrape" is not one of ["pdf" "html" "both"]`,
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("missing %q in\n%v", w, err)
+		}
+	}
+}
+
+func TestEnvOnly(t *testing.T) {
+	c, err := Load("", env(map[string]string{
+		"ACCOUNTS":                   "alice, bob",
+		"CIS_USERNAME_ALICE":         "alice",
+		"GRADE_SOURCE":               "both",
+		"GRADE_SOURCE_BOB":           "html",
+		"CHECK_SCHEDULE_OVERRIDES":   "2026-07-01..2026-07-20=*/5 * * * *",
+		"DISCORD_WEBHOOK_URL":        "https://discord.com/api/webhooks/1/abc",
+		"DISCORD_ENABLED_BOB":        "true",
+		"CHECK_INTERVAL":             "15",
+		"LOG_FILE_MAX_BACKUPS":       "3",
+		"DISCORD_WEBHOOK_URL_UNUSED": "ignored",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Accounts) != 2 || c.Accounts[0].Username != "alice" || c.Accounts[0].Source != "both" || c.Accounts[1].Source != "html" {
+		t.Errorf("accounts = %+v", c.Accounts)
+	}
+	if d := c.AccountNotify(c.Accounts[1]); !d.IsEnabled() || d.WebhookURL == "" {
+		t.Errorf("bob notify = %+v", d)
+	}
+	if c.Check.Interval != Duration(15*time.Minute) || len(c.Check.Overrides) != 1 || c.Log.MaxBackups != 3 {
+		t.Errorf("config = %+v", c)
+	}
+
+	c, err = Load("", env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Accounts) != 1 || c.Accounts[0].Name != DefaultAccount {
+		t.Errorf("accounts = %+v", c.Accounts)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, _ := Load("", env(map[string]string{"ACCOUNTS": "alice,bob", "CIS_PASSWORD_ALICE": "old-secret"}))
+	new, _ := Load("", env(map[string]string{
+		"ACCOUNTS": "bob,alice", "CIS_PASSWORD_ALICE": "new-secret", "CHECK_INTERVAL": "30", "DISCORD_ENABLED": "false",
+	}))
+	got := Diff(old, new)
+	want := []string{
+		"accounts[alice].password: (changed)",
+		"check.interval: 1h0m0s -> 30m0s",
+		"notify.discord.enabled: false",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Diff = %q, want %q", got, want)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	keyring.MockInit()
+	if err := Store("keyring:gradechecker/alice", "from-keyring"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAULT_PASSWORD", "from-env")
+	path := writeFile(t, "cis", "from-file\nsecond line\n")
+
+	for value, want := range map[string]string{
+		"literal":                    "literal",
+		"https://discord.com/api/x":  "https://discord.com/api/x",
+		"plain:file:abc":             "file:abc",
+		"file:" + path:               "from-file",
+		"env:VAULT_PASSWORD":         "from-env",
+		"cmd:echo from-cmd":          "from-cmd",
+		"keyring:gradechecker/alice": "from-keyring",
+	} {
+		got, err := Resolve(context.Background(), value)
+		if err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"env:UNSET_VARIABLE", "file:/does/not/exist", "cmd:false", "keyring:gradechecker/bob"} {
+		if _, err := Resolve(context.Background(), value); err == nil {
+			t.Errorf("Resolve(%q): expected an error", value)
+		}
+	}
+
+	c, err := Load("", env(map[string]string{"CIS_PASSWORD": "keyring:gradechecker", "API_TOKEN": "file:/run/secrets/api"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Warnings(); len(got) != 1 || !strings.Contains(got[0].Error(), "env CIS_PASSWORD: accounts[0].password: starts with keyring: but is no valid reference") ||
+		strings.Contains(got[0].Error(), "gradechecker") {
+		t.Errorf("warnings = %v", got)
+	}
+	if got := c.Secrets(); !slices.Equal(got, []string{"keyring:gradechecker"}) {
+		t.Errorf("secrets = %q, want only the malformed reference", got)
+	}
+}
+
+func TestMalformedSecretRefs(t *testing.T) {
+	for _, value := range []string{
+		"file:", "file: /run/secrets/cis", "env:", "env:my password", "env:1ST",
+		"cmd:", "cmd:   ", "keyring:", "keyring:gradechecker", "keyring:/cis", "keyring:grade checker/cis",
+	} {
+		if IsSecretRef(value) {
+			t.Errorf("IsSecretRef(%q) = true", value)
+		}
+		if got, err := Resolve(context.Background(), value); err != nil || got != value {
+			t.Errorf("Resolve(%q) = %q, %v, want it as is", value, got, err)
+		}
+	}
+	for _, value := range []string{"file:/run/secrets/cis", "file:secrets/cis", "env:VAULT_PASSWORD", "cmd:pass show nak/cis", "keyring:gradechecker/cis", "plain:", "plain:env:"} {
+		if !IsSecretRef(value) {
+			t.Errorf("IsSecretRef(%q) = false", value)
+		}
+	}
+
+	c, err := Load("", env(map[string]string{"CIS_PASSWORD": "plain:env:my password", "DISCORD_BOT_TOKEN": "cmd:"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Warnings(); len(got) != 1 || got[0].Field != "notify.discord.bot_token" {
+		t.Errorf("warnings = %v", got)
+	}
+}
+
+func TestWithoutSecrets(t *testing.T) {
+	c, err := Load("", env(map[string]string{
+		"CIS_USERNAME":        "alice",
+		"CIS_PASSWORD":        "hunter2",
+		"API_TOKEN":           "file:/run/secrets/api",
+		"DISCORD_WEBHOOK_URL": "https://discord.com/api/webhooks/1/abc",
+		"CHECK_INTERVAL":      "30",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := c.WithoutSecrets().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "webhooks") || strings.Contains(string(data), `""`) {
+		t.Errorf("marshalled config:\n%s", data)
+	}
+	if c.Accounts[0].Password != "hunter2" {
+		t.Error("WithoutSecrets changed the original")
+	}
+
+	restored, err := Load(writeFile(t, "gradechecker.yaml", string(data)), env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.API.Token != "file:/run/secrets/api" || restored.Check.Interval != c.Check.Interval ||
+		restored.Accounts[0].Username != "alice" || restored.Accounts[0].Password != "" {
+		t.Errorf("restored config = %+v", restored)
+	}
+}
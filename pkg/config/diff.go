@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Diff lists the values that differ between two configurations, one line
+// per field like `check.interval: 1h0m0s -> 30m0s`. Secrets are shown as
+// "(changed)" only.
+func Diff(old, new *Config) []string {
+	before, after := old.flatten(), new.flatten()
+	fields := make(map[string]bool)
+	for f := range before {
+		fields[f] = true
+	}
+	for f := range after {
+		fields[f] = true
+	}
+
+	var lines []string
+	for f := range fields {
+		b, okB := before[f]
+		a, okA := after[f]
+		if okB && okA && b == a {
+			continue
+		}
+		switch {
+		case !okA:
+			lines = append(lines, fmt.Sprintf("%s: removed", f))
+		case a.secret:
+			lines = append(lines, fmt.Sprintf("%s: (changed)", f))
+		case !okB:
+			lines = append(lines, fmt.Sprintf("%s: %s", f, a.value))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", f, b.value, a.value))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Secrets returns all secret values of the configuration. References are
+// left out; their values are only known once resolved.
+func (c *Config) Secrets() []string {
+	var out []string
+	for _, v := range c.flatten() {
+		if !v.secret || v.value == "" {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(v.value, "plain:"); ok {
+			out = append(out, rest)
+		} else if !IsSecretRef(v.value) {
+			out = append(out, v.value)
+		}
+	}
+	return out
+}
+
+type flatValue struct {
+	value  string
+	secret bool
+}
+
+// flatten maps the path of every set value to its text. Accounts are keyed
+// by name instead of position, so reordering them is no change.
+func (c *Config) flatten() map[string]flatValue {
+	out := make(map[string]flatValue)
+	var walk func(prefix string, v reflect.Value, secret bool)
+	walk = func(prefix string, v reflect.Value, secret bool) {
+		switch v.Kind() {
+		case reflect.Pointer:
+			// A set pointer counts even if it points to false
+			if !v.IsNil() {
+				out[prefix] = flatValue{fmt.Sprint(v.Elem().Interface()), secret}
+			}
+		case reflect.Struct:
+			t := v.Type()
+			for i := range t.NumField() {
+				f := t.Field(i)
+				name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+				if !f.IsExported() || name == "-" {
+					continue
+				}
+				walk(join(prefix, name), v.Field(i), f.Tag.Get("secret") == "true")
+			}
+		case reflect.Slice:
+			for i := range v.Len() {
+				key := fmt.Sprintf("%s[%d]", prefix, i)
+				if acc, ok := v.Index(i).Interface().(Account); ok {
+					key = fmt.Sprintf("%s[%s]", prefix, acc.Name)
+				}
+				walk(key, v.Index(i), secret)
+			}
+		default:
+			if v.IsZero() {
+				return
+			}
+			value := fmt.Sprint(v.Interface())
+			if d, ok := v.Interface().(Duration); ok {
+				value = time.Duration(d).String()
+			}
+			out[prefix] = flatValue{value, secret}
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem(), false)
+	return out
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
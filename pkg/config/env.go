@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv overrides the configuration with the environment variables the
+// bot has always read (see the README). Plain numbers in CHECK_INTERVAL and
+// CHECK_JITTER are minutes, as before.
+//
+// ACCOUNTS=alice,bob replaces the account list; accounts of the file keep
+// their settings if they are listed. Per-account variables carry the
+// account name as suffix (CIS_USERNAME_ALICE), except for the default
+// account, which uses the plain names.
+func (c *Config) applyEnv(getenv func(string) string) Errors {
+	var errs Errors
+	str := func(key, field string, dst *string) {
+		if v := strings.TrimSpace(getenv(key)); v != "" {
+			*dst = v
+			c.sources[field] = "env " + key
+		}
+	}
+	minutes := func(key, field string, dst *Duration) {
+		v := strings.TrimSpace(getenv(key))
+		if v == "" {
+			return
+		}
+		c.sources[field] = "env " + key
+		if n, err := strconv.Atoi(v); err == nil {
+			*dst = Duration(time.Duration(n) * time.Minute)
+		} else if d, err := time.ParseDuration(v); err == nil {
+			*dst = Duration(d)
+		} else {
+			errs = append(errs, c.Invalid(field, "%q is not a number of minutes or a duration like \"90s\"", v))
+		}
+	}
+	number := func(key, field string, dst *int) {
+		v := strings.TrimSpace(getenv(key))
+		if v == "" {
+			return
+		}
+		c.sources[field] = "env " + key
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, c.Invalid(field, "%q is not a number", v))
+			return
+		}
+		*dst = n
+	}
+	discord := func(suffix, prefix string, d *Discord) {
+		if v := strings.TrimSpace(getenv("DISCORD_ENABLED" + suffix)); v != "" {
+			enabled := v == "true" || v == "1" || v == "yes"
+			d.Enabled = &enabled
+			c.sources[prefix+"enabled"] = "env DISCORD_ENABLED" + suffix
+		}
+		str("DISCORD_MODE"+suffix, prefix+"mode", &d.Mode)
+		str("DISCORD_BOT_TOKEN"+suffix, prefix+"bot_token", &d.BotToken)
+		str("DISCORD_USER_ID"+suffix, prefix+"user_id", &d.UserID)
+		str("DISCORD_WEBHOOK_URL"+suffix, prefix+"webhook_url", &d.WebhookURL)
+	}
+
+	str("CHECK_SCHEDULE", "check.schedule", &c.Check.Schedule)
+	minutes("CHECK_INTERVAL", "check.interval", &c.Check.Interval)
+	minutes("CHECK_JITTER", "check.jitter", &c.Check.Jitter)
+	if v := getenv("CHECK_SCHEDULE_OVERRIDES"); strings.TrimSpace(v) != "" {
+		c.sources["check.overrides"] = "env CHECK_SCHEDULE_OVERRIDES"
+		c.Check.Overrides = nil
+		for _, spec := range strings.Split(v, ";") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			dates, expr, ok := strings.Cut(spec, "=")
+			from, to, ok2 := strings.Cut(dates, "..")
+			if !ok || !ok2 {
+				errs = append(errs, c.Invalid("check.overrides", "%q: expected FROM..TO=SCHEDULE", strings.TrimSpace(spec)))
+				continue
+			}
+			c.Check.Overrides = append(c.Check.Overrides, Override{
+				From:     strings.TrimSpace(from),
+				To:       strings.TrimSpace(to),
+				Schedule: strings.TrimSpace(expr),
+			})
+		}
+	}
+
+	str("API_ADDR", "api.addr", &c.API.Addr)
+	str("API_TOKEN", "api.token", &c.API.Token)
+
+	str("LOG_LEVEL", "log.level", &c.Log.Level)
+	str("LOG_FORMAT", "log.format", &c.Log.Format)
+	str("LOG_FILE", "log.file", &c.Log.File)
+	number("LOG_FILE_MAX_SIZE", "log.max_size", &c.Log.MaxSize)
+	number("LOG_FILE_MAX_BACKUPS", "log.max_backups", &c.Log.MaxBackups)
+
+	discord("", "notify.discord.", &c.Notify.Discord)
+
+	str("DATABASE_URL", "database.url", &c.Database.URL)
+
+	str("ENCRYPTION_PASSPHRASE", "encryption.passphrase", &c.Encryption.Passphrase)
+	str("ENCRYPTION_KEY_FILE", "encryption.key_file", &c.Encryption.KeyFile)
+
+	if names := splitList(getenv("ACCOUNTS")); len(names) > 0 {
+		accounts := make([]Account, len(names))
+		sources := make(map[string]string)
+		for i, name := range names {
+			accounts[i] = Account{Name: name}
+			for j, acc := range c.Accounts {
+				if acc.Name == name {
+					accounts[i] = acc
+					c.moveSources(fmt.Sprintf("accounts[%d]", j), fmt.Sprintf("accounts[%d]", i), sources)
+				}
+			}
+		}
+		for field := range c.sources {
+			if strings.HasPrefix(field, "accounts[") {
+				delete(c.sources, field)
+			}
+		}
+		maps.Copy(c.sources, sources)
+		c.Accounts = accounts
+		c.sources["accounts"] = "env ACCOUNTS"
+	} else if len(c.Accounts) == 0 {
+		c.Accounts = []Account{{Name: DefaultAccount}}
+	}
+
+	for i := range c.Accounts {
+		acc := &c.Accounts[i]
+		prefix := fmt.Sprintf("accounts[%d].", i)
+		suffix := ""
+		if acc.Name != DefaultAccount {
+			suffix = "_" + EnvSuffix(acc.Name)
+		}
+		str("CIS_USERNAME"+suffix, prefix+"username", &acc.Username)
+		str("CIS_PASSWORD"+suffix, prefix+"password", &acc.Password)
+		str("TRANSCRIPT_URL"+suffix, prefix+"transcript_url", &acc.TranscriptURL)
+		str("RESULTS_URL"+suffix, prefix+"results_url", &acc.ResultsURL)
+		str("GRADE_SOURCE"+suffix, prefix+"source", &acc.Source)
+		if acc.Source == "" {
+			// GRADE_SOURCE applies to all accounts without their own
+			str("GRADE_SOURCE", prefix+"source", &acc.Source)
+		}
+		if suffix != "" {
+			discord(suffix, prefix+"notify.discord.", &acc.Notify.Discord)
+		}
+	}
+	return errs
+}
+
+// moveSources copies the sources of the fields below from to the same
+// fields below to.
+func (c *Config) moveSources(from, to string, dst map[string]string) {
+	for field, source := range c.sources {
+		if rest, ok := strings.CutPrefix(field, from); ok && (rest == "" || rest[0] == '.') {
+			dst[to+rest] = source
+		}
+	}
+}
+
+// EnvKeys are the environment variables read by the configuration, not
+// counting the per-account variants of AccountEnvKeys.
+var EnvKeys = []string{
+	"CONFIG_FILE", "ACCOUNTS", "CHECK_INTERVAL", "CHECK_SCHEDULE", "CHECK_SCHEDULE_OVERRIDES", "CHECK_JITTER",
+	"API_ADDR", "API_TOKEN",
+	"LOG_LEVEL", "LOG_FORMAT", "LOG_FILE", "LOG_FILE_MAX_SIZE", "LOG_FILE_MAX_BACKUPS",
+	"DATABASE_URL", "ENCRYPTION_PASSPHRASE", "ENCRYPTION_KEY_FILE",
+}
+
+// AccountEnvKeys are the environment variables that can be set per account
+// with a suffix.
+var AccountEnvKeys = []string{
+	"CIS_USERNAME", "CIS_PASSWORD", "TRANSCRIPT_URL", "RESULTS_URL", "GRADE_SOURCE",
+	"DISCORD_ENABLED", "DISCORD_MODE", "DISCORD_BOT_TOKEN", "DISCORD_USER_ID", "DISCORD_WEBHOOK_URL",
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
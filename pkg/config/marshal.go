@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WithoutSecrets returns a copy of the configuration with every secret
+// removed. References are kept, as they do not contain the secret.
+func (c *Config) WithoutSecrets() *Config {
+	out := *c
+	out.Accounts = slices.Clone(c.Accounts)
+	out.sources = nil
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Struct:
+			t := v.Type()
+			for i := range t.NumField() {
+				f := t.Field(i)
+				if !f.IsExported() {
+					continue
+				}
+				if f.Tag.Get("secret") == "true" && !IsSecretRef(v.Field(i).String()) {
+					v.Field(i).SetString("")
+					continue
+				}
+				walk(v.Field(i))
+			}
+		case reflect.Slice:
+			for i := range v.Len() {
+				walk(v.Index(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(&out).Elem())
+	return &out
+}
+
+// Marshal returns the configuration as a YAML configuration file. Empty
+// values are left out.
+func (c *Config) Marshal() ([]byte, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	prune(&doc)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// prune removes empty scalars and collections from a YAML document and
+// reports whether n itself is empty.
+func prune(n *yaml.Node) bool {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return len(n.Content) == 0 || prune(n.Content[0])
+	case yaml.MappingNode:
+		var kept []*yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if !prune(n.Content[i+1]) {
+				kept = append(kept, n.Content[i], n.Content[i+1])
+			}
+		}
+		n.Content = kept
+	case yaml.SequenceNode:
+		n.Content = slices.DeleteFunc(n.Content, prune)
+	case yaml.ScalarNode:
+		return n.Tag == "!!null" || n.Value == ""
+	}
+	return len(n.Content) == 0
+}
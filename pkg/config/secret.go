@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Secret values (passwords, tokens, webhook URLs) can be references that
+// are resolved each time the secret is used, so it need not be stored in
+// plaintext:
+//
+//	file:/run/secrets/cis     the first line of a file
+//	env:CIS_PASSWORD_VAULT    another environment variable
+//	cmd:pass show nak/cis     the first output line of a command (run without a shell)
+//	keyring:gradechecker/cis  the OS keyring (Secret Service on Linux), as SERVICE/USER
+//	plain:file:abc            the rest as is, for secrets starting with a prefix
+//
+// Any other value is the secret itself, including one that starts with a
+// prefix but is no well-formed reference (see SecretScheme).
+var secretSchemes = []string{"file", "env", "cmd", "keyring", "plain"}
+
+// cmdTimeout limits how long a cmd: reference may take, e.g. for a
+// password manager asking for its passphrase.
+const cmdTimeout = 30 * time.Second
+
+// IsSecretRef reports whether a secret value is a well-formed reference.
+func IsSecretRef(value string) bool {
+	scheme := SecretScheme(value)
+	if scheme == "" {
+		return false
+	}
+	_, ref, _ := strings.Cut(value, ":")
+	return wellFormedRef(scheme, ref)
+}
+
+// SecretScheme returns the reference prefix a secret value starts with,
+// or "" if it has none. A value with a prefix that is no well-formed
+// reference, like "file:" or "env:my password", is taken as the secret
+// itself; those should be written with the plain: prefix instead.
+func SecretScheme(value string) string {
+	scheme, _, ok := strings.Cut(value, ":")
+	if ok && slices.Contains(secretSchemes, scheme) {
+		return scheme
+	}
+	return ""
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// wellFormedRef checks the syntax of a reference without resolving it.
+func wellFormedRef(scheme, ref string) bool {
+	switch scheme {
+	case "plain":
+		return true
+	case "file":
+		return ref != "" && ref == strings.TrimSpace(ref) && !strings.ContainsAny(ref, "\r\n")
+	case "env":
+		return envName.MatchString(ref)
+	case "cmd":
+		return ref == strings.TrimSpace(ref) && len(strings.Fields(ref)) > 0
+	case "keyring":
+		service, user, ok := keyringRef(ref)
+		return ok && !strings.ContainsAny(service+user, " \t\r\n")
+	}
+	return false
+}
+
+// Resolve returns the secret a value stands for; values that are no
+// reference are returned unchanged. Resolved secrets are never cached.
+func Resolve(ctx context.Context, value string) (string, error) {
+	if !IsSecretRef(value) {
+		return value, nil
+	}
+	scheme, ref, _ := strings.Cut(value, ":")
+	secret, err := resolve(ctx, scheme, ref)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", value, err)
+	}
+	if secret == "" && scheme != "plain" {
+		return "", fmt.Errorf("secret %s is empty", value)
+	}
+	return secret, nil
+}
+
+func resolve(ctx context.Context, scheme, ref string) (string, error) {
+	switch scheme {
+	case "plain":
+		return ref, nil
+	case "file":
+		data, err := os.ReadFile(ref)
+		if err != nil {
+			return "", err
+		}
+		return firstLine(data), nil
+	case "env":
+		v, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", errors.New("variable not set")
+		}
+		return strings.TrimSpace(v), nil
+	case "cmd":
+		args := strings.Fields(ref)
+		if len(args) == 0 {
+			return "", errors.New("no command")
+		}
+		ctx, cancel := context.WithTimeout(ctx, cmdTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			// The error output is shown, the output might hold the secret
+			return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return firstLine(out), nil
+	case "keyring":
+		service, user, ok := keyringRef(ref)
+		if !ok {
+			return "", errors.New("expected keyring:SERVICE/USER")
+		}
+		return keyring.Get(service, user)
+	}
+	return "", fmt.Errorf("unknown scheme %q", scheme)
+}
+
+// Store saves a secret in the OS keyring under a keyring: reference.
+func Store(ref, secret string) error {
+	scheme, rest, _ := strings.Cut(ref, ":")
+	service, user, ok := keyringRef(rest)
+	if scheme != "keyring" || !ok {
+		return fmt.Errorf("%q is not keyring:SERVICE/USER", ref)
+	}
+	return keyring.Set(service, user, secret)
+}
+
+// keyringRef splits the SERVICE/USER part of a keyring: reference.
+func keyringRef(ref string) (service, user string, ok bool) {
+	service, user, ok = strings.Cut(ref, "/")
+	return service, user, ok && service != "" && user != ""
+}
+
+func firstLine(data []byte) string {
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimSpace(line)
+}
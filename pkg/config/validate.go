@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// validate checks the values that can be checked without the bot: the
+// schedule expressions are parsed by the bot itself. Missing credentials
+// are not an error, as the dashboard starts the bot before they are set.
+func (c *Config) validate() Errors {
+	var errs Errors
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, c.Invalid(field, format, args...))
+	}
+	oneOf := func(field, v string, allowed ...string) {
+		if v == "" {
+			return
+		}
+		for _, a := range allowed {
+			if v == a {
+				return
+			}
+		}
+		invalid(field, "%q is not one of %q", v, allowed)
+	}
+	httpURL := func(field, v string) {
+		if v == "" {
+			return
+		}
+		if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid(field, "%q is not an http(s) URL", v)
+		}
+	}
+	// secretRef reports whether v is a secret reference. A malformed one
+	// is the secret itself, which is only a warning: it may be a password
+	// that happens to start with a prefix.
+	secretRef := func(field, v string) bool {
+		if IsSecretRef(v) {
+			return true
+		}
+		if scheme := SecretScheme(v); scheme != "" {
+			// The value may be the secret, so it is not shown
+			c.warnings = append(c.warnings, c.Invalid(field, "starts with %s: but is no valid reference, so it is used as the secret itself; fix the reference or write plain:%s:...", scheme, scheme))
+		}
+		return false
+	}
+	discord := func(prefix string, d Discord) {
+		oneOf(prefix+"mode", d.Mode, "webhook", "dm")
+		secretRef(prefix+"bot_token", d.BotToken)
+		if d.WebhookURL != "" && !secretRef(prefix+"webhook_url", d.WebhookURL) {
+			if u, err := url.Parse(d.WebhookURL); err != nil || u.Scheme != "https" || u.Host == "" {
+				// The URL itself is a secret, so it is not shown
+				invalid(prefix+"webhook_url", "is not an https URL")
+			}
+		}
+		if _, err := strconv.ParseUint(d.UserID, 10, 64); d.UserID != "" && err != nil {
+			invalid(prefix+"user_id", "%q is not a numeric Discord user ID", d.UserID)
+		}
+	}
+
+	if time.Duration(c.Check.Interval) < time.Minute {
+		invalid("check.interval", "%s is shorter than 1m", time.Duration(c.Check.Interval))
+	}
+	if c.Check.Jitter < 0 {
+		invalid("check.jitter", "%s is negative", time.Duration(c.Check.Jitter))
+	}
+	for i, o := range c.Check.Overrides {
+		field := fmt.Sprintf("check.overrides[%d]", i)
+		from, errFrom := time.Parse(time.DateOnly, o.From)
+		if errFrom != nil {
+			invalid(field+".from", "%q is not a date like 2026-07-01", o.From)
+		}
+		to, errTo := time.Parse(time.DateOnly, o.To)
+		if errTo != nil {
+			invalid(field+".to", "%q is not a date like 2026-07-20", o.To)
+		}
+		if errFrom == nil && errTo == nil && to.Before(from) {
+			invalid(field+".to", "%s is before %s", o.To, o.From)
+		}
+		if o.Schedule == "" {
+			invalid(field+".schedule", "is empty")
+		}
+	}
+
+	if c.API.Addr != "off" {
+		if _, port, err := net.SplitHostPort(c.API.Addr); err != nil || port == "" {
+			invalid("api.addr", "%q is not HOST:PORT or \"off\"", c.API.Addr)
+		}
+	}
+
+	secretRef("api.token", c.API.Token)
+
+	oneOf("log.level", c.Log.Level, "debug", "info", "warn", "error")
+	oneOf("log.format", c.Log.Format, "text", "json")
+	if c.Log.MaxSize < 1 {
+		invalid("log.max_size", "%d is not a positive number of megabytes", c.Log.MaxSize)
+	}
+	if c.Log.MaxBackups < 1 {
+		invalid("log.max_backups", "%d is not a positive number", c.Log.MaxBackups)
+	}
+
+	discord("notify.discord.", c.Notify.Discord)
+
+	if c.Database.URL != "" && !secretRef("database.url", c.Database.URL) {
+		if u, err := url.Parse(c.Database.URL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			// The URL may hold the password, so it is not shown
+			invalid("database.url", "is not a postgres:// URL; leave it empty to use grades.db")
+		}
+	}
+
+	secretRef("encryption.passphrase", c.Encryption.Passphrase)
+	if c.Encryption.Passphrase != "" && c.Encryption.KeyFile != "" {
+		invalid("encryption.key_file", "set either a passphrase or a key file, not both")
+	}
+
+	seen := make(map[string]string)
+	for i, acc := range c.Accounts {
+		field := fmt.Sprintf("accounts[%d]", i)
+		if acc.Name == "" {
+			invalid(field+".name", "is empty")
+		} else if other, ok := seen[EnvSuffix(acc.Name)]; ok {
+			invalid(field+".name", "%q clashes with account %q (both use the suffix _%s)", acc.Name, other, EnvSuffix(acc.Name))
+		} else {
+			seen[EnvSuffix(acc.Name)] = acc.Name
+		}
+		secretRef(field+".password", acc.Password)
+		httpURL(field+".transcript_url", acc.TranscriptURL)
+		httpURL(field+".results_url", acc.ResultsURL)
+		oneOf(field+".source", acc.Source, "pdf", "html", "both")
+		discord(field+".notify.discord.", acc.Notify.Discord)
+	}
+	return errs
+}
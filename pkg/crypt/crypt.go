@@ -0,0 +1,160 @@
+// Package crypt encrypts data at rest with AES-256-GCM under a key derived
+// from a passphrase (scrypt) or read from a key file.
+//
+// Short values, such as database columns, are sealed into printable strings
+// starting with "enc:"; files get a binary header. Both carry their own
+// random nonce, so sealing the same value twice gives different results.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// ValuePrefix starts every sealed value.
+	ValuePrefix = "enc:"
+	// SaltSize is the size of the salt of a passphrase.
+	SaltSize = 16
+	// KeyFileSize is the number of random bytes in a generated key file.
+	KeyFileSize = 32
+)
+
+// fileMagic starts every sealed file.
+var fileMagic = []byte("GCENC1\n")
+
+// ErrWrongKey is returned when data was sealed with another key.
+var ErrWrongKey = errors.New("wrong key, or the data is corrupted")
+
+// Key seals and opens data.
+type Key struct {
+	aead cipher.AEAD
+}
+
+// FromPassphrase derives a key from a passphrase and salt. The scrypt
+// parameters take about 100ms, which is paid once on startup.
+func FromPassphrase(passphrase string, salt []byte) (*Key, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	k, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(k)
+}
+
+// FromKeyFile derives a key from the contents of a key file. Files written
+// by NewKeyFile hold hex; any other content of at least 32 bytes is hashed.
+func FromKeyFile(data []byte) (*Key, error) {
+	text := strings.TrimSpace(string(data))
+	if k, err := hex.DecodeString(text); err == nil && len(k) == KeyFileSize {
+		return newKey(k)
+	}
+	if len(data) < KeyFileSize {
+		return nil, fmt.Errorf("key file too short (%d bytes, need at least %d)", len(data), KeyFileSize)
+	}
+	k := sha256.Sum256(data)
+	return newKey(k[:])
+}
+
+// NewKeyFile returns the contents of a new random key file.
+func NewKeyFile() []byte {
+	return []byte(hex.EncodeToString(random(KeyFileSize)) + "\n")
+}
+
+// NewSalt returns a random salt for FromPassphrase.
+func NewSalt() []byte {
+	return random(SaltSize)
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	return b
+}
+
+func newKey(k []byte) (*Key, error) {
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{aead}, nil
+}
+
+func (k *Key) seal(plaintext []byte) []byte {
+	nonce := random(k.aead.NonceSize())
+	return k.aead.Seal(nonce, nonce, plaintext, nil)
+}
+
+func (k *Key) open(sealed []byte) ([]byte, error) {
+	n := k.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, ErrWrongKey
+	}
+	plaintext, err := k.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plaintext, nil
+}
+
+// SealValue encrypts a value into a printable string.
+func (k *Key) SealValue(value string) string {
+	return ValuePrefix + base64.RawStdEncoding.EncodeToString(k.seal([]byte(value)))
+}
+
+// IsSealedValue reports whether a value was encrypted by SealValue.
+func IsSealedValue(value string) bool {
+	return strings.HasPrefix(value, ValuePrefix)
+}
+
+// OpenValue decrypts a value from SealValue. Values that are not sealed
+// are returned as they are.
+func (k *Key) OpenValue(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, ValuePrefix)
+	if !ok {
+		return value, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrWrongKey
+	}
+	plaintext, err := k.open(sealed)
+	return string(plaintext), err
+}
+
+// SealFile encrypts the contents of a file.
+func (k *Key) SealFile(data []byte) []byte {
+	return append(bytes.Clone(fileMagic), k.seal(data)...)
+}
+
+// IsSealedFile reports whether file contents were encrypted by SealFile.
+func IsSealedFile(data []byte) bool {
+	return bytes.HasPrefix(data, fileMagic)
+}
+
+// OpenFile decrypts file contents from SealFile. Contents that are not
+// sealed are returned as they are.
+func (k *Key) OpenFile(data []byte) ([]byte, error) {
+	if !IsSealedFile(data) {
+		return data, nil
+	}
+	return k.open(data[len(fileMagic):])
+}
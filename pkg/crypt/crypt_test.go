@@ -0,0 +1,45 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	salt := NewSalt()
+	k, err := FromPassphrase("correct horse", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := k.SealValue("1,7")
+	if !IsSealedValue(sealed) || sealed == k.SealValue("1,7") {
+		t.Errorf("SealValue = %q, should be sealed with a fresh nonce", sealed)
+	}
+	if got, err := k.OpenValue(sealed); err != nil || got != "1,7" {
+		t.Errorf("OpenValue = %q, %v", got, err)
+	}
+	if got, err := k.OpenValue("2,0"); err != nil || got != "2,0" {
+		t.Errorf("OpenValue of a plain value = %q, %v", got, err)
+	}
+
+	file := k.SealFile([]byte("%PDF-1.4"))
+	if got, err := k.OpenFile(file); err != nil || !bytes.Equal(got, []byte("%PDF-1.4")) {
+		t.Errorf("OpenFile = %q, %v", got, err)
+	}
+
+	other, err := FromKeyFile(NewKeyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.OpenValue(sealed); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("OpenValue with another key: %v", err)
+	}
+	if _, err := other.OpenFile(file); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("OpenFile with another key: %v", err)
+	}
+	if _, err := FromKeyFile([]byte("short")); err == nil {
+		t.Error("a short key file should be rejected")
+	}
+}
@@ -21,27 +21,29 @@ class BotManager {
         this.log(`Starting bot from: ${botPath}`);
 
         try {
-            this.process = spawn(botPath, [], {
+            const child = spawn(botPath, [], {
                 cwd: process.cwd(),
                 env: process.env // Inherit env (including .env loaded by Astro/Node)
             });
+            this.process = child;
 
-            this.process.stdout?.on('data', (data) => {
+            child.stdout?.on('data', (data) => {
                 this.log(data.toString());
             });
 
-            this.process.stderr?.on('data', (data) => {
+            child.stderr?.on('data', (data) => {
                 this.log(data.toString());
             });
 
-            this.process.on('close', (code) => {
+            // A stopped bot may exit after a new one was started
+            child.on('close', (code) => {
                 this.log(`Bot process exited with code ${code}`);
-                this.process = null;
+                if (this.process === child) this.process = null;
             });
 
-            this.process.on('error', (err) => {
+            child.on('error', (err) => {
                 this.log(`Failed to start bot: ${err.message}`);
-                this.process = null;
+                if (this.process === child) this.process = null;
             });
 
         } catch (error: any) {
@@ -51,15 +53,30 @@ class BotManager {
 
     public stop() {
         if (this.process) {
+            // SIGTERM lets the bot finish the running check first
             this.log('Stopping bot...');
-            this.process.kill();
+            this.process.kill('SIGTERM');
             this.process = null;
         }
     }
 
     public restart() {
+        const old = this.process;
         this.stop();
-        setTimeout(() => this.start(), 1000); // Give it a moment to cleanup
+        if (old && old.exitCode === null) {
+            old.once('close', () => this.start());
+        } else {
+            this.start();
+        }
+    }
+
+    // Asks the running bot to check right away (SIGUSR1, not available on Windows).
+    public checkNow(): boolean {
+        if (!this.process || process.platform === 'win32') {
+            return false;
+        }
+        this.log('Check requested.');
+        return this.process.kill('SIGUSR1');
     }
 
     public getLogs() {
@@ -0,0 +1,32 @@
+import { spawnSync } from 'node:child_process';
+import * as fs from 'node:fs';
+import * as path from 'node:path';
+
+// Secrets entered in the settings are not written to .env in plaintext.
+// They go into the OS keyring through the bot, or into a file only the
+// owner can read where there is no keyring (e.g. a headless server). .env
+// then holds the reference, see "Secrets" in the README.
+const secretsDir = path.resolve('secrets');
+
+// storeSecret stores the secret of an .env variable and returns the
+// reference to write instead.
+export function storeSecret(name: string, secret: string): string {
+    const key = name.toLowerCase();
+    const botPath = process.env.BOT_BINARY_PATH || path.resolve('gradechecker');
+    const ref = `keyring:gradechecker/${key}`;
+    const result = spawnSync(botPath, ['secret', 'set', ref], {
+        cwd: process.cwd(),
+        input: secret + '\n',
+    });
+    if (result.status === 0) {
+        return ref;
+    }
+    console.warn(`No keyring available (${result.stderr?.toString().trim() || result.error?.message}), storing ${name} in ${secretsDir}`);
+
+    fs.mkdirSync(secretsDir, { recursive: true, mode: 0o700 });
+    const file = path.join(secretsDir, key);
+    fs.writeFileSync(file, secret + '\n', { mode: 0o600 });
+    // The mode only applies to new files
+    fs.chmodSync(file, 0o600);
+    return `file:${file}`;
+}
@@ -18,6 +18,17 @@ export const POST: APIRoute = async ({ request }) => {
                 status: 200,
                 headers: { 'Content-Type': 'application/json' }
             });
+        } else if (action === 'check') {
+            if (!botManager.checkNow()) {
+                return new Response(JSON.stringify({ success: false, message: 'Bot is not running or cannot be signalled on this platform' }), {
+                    status: 409,
+                    headers: { 'Content-Type': 'application/json' }
+                });
+            }
+            return new Response(JSON.stringify({ success: true, message: 'Check requested' }), {
+                status: 200,
+                headers: { 'Content-Type': 'application/json' }
+            });
         } else {
             return new Response(JSON.stringify({ success: false, message: 'Invalid action' }), {
                 status: 400,
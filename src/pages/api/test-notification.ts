@@ -6,7 +6,7 @@ export const POST: APIRoute = async () => {
     const botPath = path.resolve('gradechecker');
 
     return new Promise((resolve) => {
-        exec(`${botPath} --test`, { cwd: process.cwd() }, (error, stdout, stderr) => {
+        exec(`${botPath} test-notify`, { cwd: process.cwd() }, (error, stdout, stderr) => {
             if (error) {
                 console.error(`Test notification failed: ${error.message}`);
                 resolve(new Response(JSON.stringify({